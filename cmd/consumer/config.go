@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/rodney-b/swish-test-consumer/internal/app/consumer"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+)
+
+const configUsage = `usage: consumer config print [-output text|json] [flags]
+
+Prints the effective config, the source each value came from (flag, env, secret, file or default)
+and every validation error. Secrets are masked.
+Exits with a non-zero status if the config is invalid.
+
+flags:`
+
+// runConfigCommand runs the "config" command and returns the process exit code
+func runConfigCommand(args []string) int {
+	flags := flag.NewFlagSet("config print", flag.ContinueOnError)
+	output := flags.String("output", "text", "output format: text or json")
+	cf := addConfigFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, configUsage)
+		flags.PrintDefaults()
+	}
+
+	if len(args) == 0 || args[0] != "print" {
+		flags.Usage()
+		return 2
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if err := cf.apply(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid flags:\n%v\n", err)
+		return 2
+	}
+
+	entries, configErr := config.Explain()
+	if configErr == nil {
+		configErr = validateRoutingRules()
+	}
+
+	var err error
+	switch *output {
+	case "text":
+		err = printConfigText(os.Stdout, entries)
+	case "json":
+		err = printConfigJSON(os.Stdout, entries, configErr)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown output format %q\n", *output)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error printing config: %v\n", err)
+		return 1
+	}
+
+	if configErr != nil {
+		fmt.Fprintf(os.Stderr, "invalid config:\n%v\n", configErr)
+		return 1
+	}
+
+	return 0
+}
+
+// validateRoutingRules checks the routing rules of the config only route records to the
+// handlers of the consumer
+func validateRoutingRules() error {
+	appConfig, err := config.InitAppConfig()
+	if err != nil {
+		return err
+	}
+
+	return consumer.ValidateRoutingRules(appConfig, consumer.Options{Handlers: handlers})
+}
+
+func printConfigText(w io.Writer, entries []config.Entry) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tVALUE\tSOURCE")
+	for _, entry := range entries {
+		source := entry.Source
+		if source == "" {
+			source = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", entry.Name, entry.Value, source)
+	}
+
+	return tw.Flush()
+}
+
+func printConfigJSON(w io.Writer, entries []config.Entry, configErr error) error {
+	output := struct {
+		Entries []config.Entry `json:"entries"`
+		Valid   bool           `json:"valid"`
+		Error   string         `json:"error,omitempty"`
+	}{
+		Entries: entries,
+		Valid:   configErr == nil,
+	}
+	if configErr != nil {
+		output.Error = configErr.Error()
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(output)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/logger"
+)
+
+// configFlags are the flags overriding config values, by their environment variable names
+type configFlags struct {
+	values map[string]string
+}
+
+// addConfigFlags adds the flags overriding config values to flags
+func addConfigFlags(flags *flag.FlagSet) *configFlags {
+	cf := &configFlags{values: map[string]string{}}
+
+	flags.Func("set", "<NAME>=<value> config value to set by its environment variable name, overriding the env, "+
+		"secrets and config file (repeatable)", func(val string) error {
+		name, value, ok := strings.Cut(val, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("%q is not a <NAME>=<value> config value", val)
+		}
+		cf.values[name] = value
+		return nil
+	})
+	cf.alias(flags, "brokers", "MESSAGE_QUEUE_URL", "comma-separated seed brokers")
+	cf.listAlias(flags, "topics", "MESSAGE_QUEUE_TOPICS", "topic to consume (repeatable)")
+	cf.alias(flags, "group", "MESSAGE_QUEUE_GROUP_ID", "consumer group ID")
+	cf.alias(flags, "log-level", "LOG_LEVEL", "log level: debug, info, warn or error")
+
+	return cf
+}
+
+// alias adds a flag setting the config value envName
+func (cf *configFlags) alias(flags *flag.FlagSet, name, envName, usage string) {
+	flags.Func(name, usage+" (sets "+envName+")", func(val string) error {
+		cf.values[envName] = val
+		return nil
+	})
+}
+
+// listAlias adds a repeatable flag setting the config value envName, a list separated by newlines
+func (cf *configFlags) listAlias(flags *flag.FlagSet, name, envName, usage string) {
+	flags.Func(name, usage+" (sets "+envName+")", func(val string) error {
+		if cf.values[envName] != "" {
+			val = cf.values[envName] + "\n" + val
+		}
+		cf.values[envName] = val
+		return nil
+	})
+}
+
+// apply sets the config values of the flags, so they're used when the config is loaded
+func (cf *configFlags) apply() error {
+	return config.Override(cf.values)
+}
+
+// load loads the config with the values of the flags, and initializes the logger with it
+func (cf *configFlags) load() (config.ConfigProvider, error) {
+	err := cf.apply()
+	if err != nil {
+		return nil, err
+	}
+
+	appConfig, err := config.InitAppConfig()
+	if err != nil {
+		return nil, err
+	}
+	logger.Initialize(appConfig)
+
+	return appConfig, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/healthcheck"
+)
+
+const healthcheckUsage = `usage: consumer healthcheck [-check liveness|readiness|certificates] [-address host:port] [-timeout d] [flags]
+
+Asks the health server of a running consumer for the status of a check, like a gRPC probe does.
+Exits with a non-zero status unless the check is serving.
+
+flags:`
+
+// runHealthcheckCommand runs the "healthcheck" command and returns the process exit code
+func runHealthcheckCommand(args []string) int {
+	flags := flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	check := flags.String("check", healthcheck.LivenessCheck, "check to query: liveness, readiness or certificates")
+	address := flags.String("address", "", "address of the health server (default localhost:<HEALTHCHECK_PORT>)")
+	timeout := flags.Duration("timeout", 5*time.Second, "time to wait for the health server")
+	cf := addConfigFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, healthcheckUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	switch *check {
+	case healthcheck.LivenessCheck, healthcheck.ReadinessCheck, healthcheck.CertificatesCheck:
+	default:
+		fmt.Fprintf(os.Stderr, "unknown check %q\n", *check)
+		return 2
+	}
+
+	appConfig, err := cf.load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error initializing the application config: %v\n", err)
+		return 1
+	}
+	if *address == "" {
+		*address = fmt.Sprintf("localhost:%d", appConfig.GetHealthcheckPort())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	service := healthcheck.ServiceName(appConfig, *check)
+	status, err := healthcheck.Check(ctx, *address, service)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error checking %s: %v\n", service, err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stdout, "%s: %s\n", service, status)
+	if status != healthgrpc.HealthCheckResponse_SERVING {
+		return 1
+	}
+
+	return 0
+}
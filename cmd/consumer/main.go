@@ -1,28 +1,67 @@
 package main
 
 import (
-	"log/slog"
+	"fmt"
 	"os"
+	"strings"
+	"text/tabwriter"
 
-	"github.com/rodney-b/swish-test-consumer/internal/app/consumer"
-	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
-	"github.com/rodney-b/swish-test-consumer/internal/pkg/logger"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/handler"
 )
 
+// command is a subcommand of the consumer, run with its arguments and returning the process
+// exit code
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands = []command{
+	{name: "run", summary: "consume the configured topics (the default command)", run: runRunCommand},
+	{name: "config", summary: "print the effective config", run: runConfigCommand},
+	{name: "tail", summary: "print the records of the consumed topics", run: runTailCommand},
+	{name: "offsets", summary: "print the offsets of the partitions of the consumed topics", run: runOffsetsCommand},
+	{name: "lag", summary: "print the lag of the group", run: runLagCommand},
+	{name: "replay", summary: "replay the records of the dead letter topic", run: runReplayCommand},
+	{name: "healthcheck", summary: "check the health of a running consumer", run: runHealthcheckCommand},
+}
+
+// handlers are the named handlers routing rules can route records to. The consumer registers none,
+// so rules routing to a handler fail the config check and the startup
+var handlers map[string]handler.Handler
+
 func main() {
-	appConfig, err := config.InitAppConfig()
-	if err != nil {
-		errLog := slog.New(slog.NewJSONHandler(os.Stdout, nil)).With("package", "main")
-		errLog.Error("error initializing the application config", "error", err.Error())
+	args := os.Args[1:]
+
+	// running without a command, or with flags only, runs the consumer
+	name := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		printUsage()
 		return
 	}
 
-	logger.Initialize(appConfig)
-	log := logger.New("main")
+	for _, cmd := range commands {
+		if cmd.name == name {
+			os.Exit(cmd.run(args))
+		}
+	}
 
-	err = consumer.Run(appConfig)
-	if err != nil {
-		log.Error("consumer error", "error", err.Error())
-		return
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	printUsage()
+	os.Exit(2)
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "usage: consumer [command] [flags]\n\ncommands:")
+	tw := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
 	}
+	tw.Flush()
+	fmt.Fprintln(os.Stderr, "\nRun consumer <command> -h for the flags of a command. "+
+		"Every command takes flags overriding config values, e.g. -brokers or -set NAME=value.")
 }
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/kafka"
+)
+
+const offsetsUsage = `usage: consumer offsets [-output text|json] [flags]
+
+Prints the start and end offsets of every partition of the consumed topics (and their retry
+topics), and the offset committed by the group, if any.
+
+flags:`
+
+const lagUsage = `usage: consumer lag [-output text|json] [-max-lag n] [flags]
+
+Prints the state of the group and the lag of every partition it committed offsets for or is
+assigned. Exits with a non-zero status if the total lag is over -max-lag.
+
+flags:`
+
+// partitionOffsets are the offsets of a partition printed by the offsets command. Committed is
+// -1 if the group has no committed offset for the partition.
+type partitionOffsets struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Start     int64  `json:"start"`
+	End       int64  `json:"end"`
+	Committed int64  `json:"committed"`
+}
+
+// partitionLag is the lag of a partition printed by the lag command. Committed and Lag are -1 if
+// the group has no committed offset for the partition, and Member is empty if it's not assigned.
+type partitionLag struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Member    string `json:"member"`
+	Committed int64  `json:"committed"`
+	End       int64  `json:"end"`
+	Lag       int64  `json:"lag"`
+}
+
+// runOffsetsCommand runs the "offsets" command and returns the process exit code
+func runOffsetsCommand(args []string) int {
+	flags := flag.NewFlagSet("offsets", flag.ContinueOnError)
+	output := flags.String("output", "text", "output format: text or json")
+	cf := addConfigFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, offsetsUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "unknown output format %q\n", *output)
+		return 2
+	}
+
+	return withAdminClient(cf, func(ctx context.Context, cp config.ConfigProvider, adm *kadm.Client) int {
+		offsets, err := listPartitionOffsets(ctx, cp, adm)
+		if err == nil && *output == "json" {
+			err = printJSON(os.Stdout, offsets)
+		} else if err == nil {
+			err = printOffsetsText(os.Stdout, offsets)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error listing offsets: %v\n", err)
+			return 1
+		}
+
+		return 0
+	})
+}
+
+// runLagCommand runs the "lag" command and returns the process exit code
+func runLagCommand(args []string) int {
+	flags := flag.NewFlagSet("lag", flag.ContinueOnError)
+	output := flags.String("output", "text", "output format: text or json")
+	maxLag := flags.Int64("max-lag", -1, "total lag over which to exit with a non-zero status, or -1 to ignore the lag")
+	cf := addConfigFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, lagUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "unknown output format %q\n", *output)
+		return 2
+	}
+
+	return withAdminClient(cf, func(ctx context.Context, cp config.ConfigProvider, adm *kadm.Client) int {
+		group := cp.GetMessageQueueGroupID()
+		lags, err := adm.Lag(ctx, group)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error describing the lag of group %s: %v\n", group, err)
+			return 1
+		}
+		described := lags[group]
+		if err := errors.Join(described.DescribeErr, described.FetchErr); err != nil {
+			fmt.Fprintf(os.Stderr, "error describing the lag of group %s: %v\n", group, err)
+			return 1
+		}
+
+		partitions := groupLag(described.Lag)
+		total := described.Lag.Total()
+		if *output == "json" {
+			err = printJSON(os.Stdout, struct {
+				Group      string         `json:"group"`
+				State      string         `json:"state"`
+				Members    int            `json:"members"`
+				Total      int64          `json:"total"`
+				Partitions []partitionLag `json:"partitions"`
+			}{group, described.State, len(described.Members), total, partitions})
+		} else {
+			fmt.Fprintf(os.Stdout, "group %s is %s with %d members and a total lag of %d\n\n",
+				group, described.State, len(described.Members), total)
+			err = printLagText(os.Stdout, partitions)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error printing the lag: %v\n", err)
+			return 1
+		}
+
+		if *maxLag >= 0 && total > *maxLag {
+			fmt.Fprintf(os.Stderr, "total lag %d is over %d\n", total, *maxLag)
+			return 1
+		}
+
+		return 0
+	})
+}
+
+// withAdminClient loads the config with the flags of cf and runs fn with an admin client
+func withAdminClient(cf *configFlags, fn func(context.Context, config.ConfigProvider, *kadm.Client) int) int {
+	appConfig, err := cf.load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error initializing the application config: %v\n", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	adm, err := kafka.NewAdminClient(ctx, appConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error creating kafka admin client: %v\n", err)
+		return 1
+	}
+	defer adm.Close()
+
+	return fn(ctx, appConfig, adm)
+}
+
+// listPartitionOffsets returns the offsets of the partitions of the consumed topics
+func listPartitionOffsets(ctx context.Context, cp config.ConfigProvider, adm *kadm.Client) ([]partitionOffsets, error) {
+	topics, err := kafka.ConsumedTopics(ctx, adm, cp)
+	if err != nil {
+		return nil, err
+	}
+	// listing the offsets of no topics lists every topic of the cluster
+	if len(topics) == 0 {
+		return nil, errors.New("no consumed topics")
+	}
+
+	start, err := adm.ListStartOffsets(ctx, topics...)
+	if err == nil {
+		err = start.Error()
+	}
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to list the start offsets"), err)
+	}
+	end, err := adm.ListEndOffsets(ctx, topics...)
+	if err == nil {
+		err = end.Error()
+	}
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to list the end offsets"), err)
+	}
+	committed, err := adm.FetchOffsets(ctx, cp.GetMessageQueueGroupID())
+	if err == nil {
+		err = committed.Error()
+	}
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to fetch the committed offsets"), err)
+	}
+
+	var offsets []partitionOffsets
+	for _, o := range end.Offsets().Sorted() {
+		po := partitionOffsets{Topic: o.Topic, Partition: o.Partition, End: o.At, Committed: -1}
+		if s, ok := start.Lookup(o.Topic, o.Partition); ok {
+			po.Start = s.Offset
+		}
+		if c, ok := committed.Lookup(o.Topic, o.Partition); ok && c.At >= 0 {
+			po.Committed = c.At
+		}
+		offsets = append(offsets, po)
+	}
+
+	return offsets, nil
+}
+
+// groupLag returns the lag of every partition of lag
+func groupLag(lag kadm.GroupLag) []partitionLag {
+	var partitions []partitionLag
+	for _, l := range lag.Sorted() {
+		pl := partitionLag{Topic: l.Topic, Partition: l.Partition, Committed: l.Commit.At, End: l.End.Offset, Lag: l.Lag}
+		if l.Member != nil {
+			pl.Member = l.Member.MemberID
+			if l.Member.InstanceID != nil {
+				pl.Member = *l.Member.InstanceID
+			}
+		}
+		partitions = append(partitions, pl)
+	}
+
+	return partitions
+}
+
+func printOffsetsText(w io.Writer, offsets []partitionOffsets) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TOPIC\tPARTITION\tSTART\tEND\tCOMMITTED")
+	for _, o := range offsets {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\n", o.Topic, o.Partition, o.Start, o.End, orDash(o.Committed))
+	}
+
+	return tw.Flush()
+}
+
+func printLagText(w io.Writer, partitions []partitionLag) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TOPIC\tPARTITION\tMEMBER\tCOMMITTED\tEND\tLAG")
+	for _, p := range partitions {
+		member := p.Member
+		if member == "" {
+			member = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%d\t%s\n", p.Topic, p.Partition, member, orDash(p.Committed), p.End, orDash(p.Lag))
+	}
+
+	return tw.Flush()
+}
+
+// orDash formats offsets and lags, with a dash for the unknown ones
+func orDash(n int64) string {
+	if n < 0 {
+		return "-"
+	}
+	return fmt.Sprint(n)
+}
+
+func printJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
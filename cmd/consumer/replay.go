@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/rodney-b/swish-test-consumer/internal/app/consumer"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/logger"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/router"
+)
+
+const replayUsage = `usage: consumer replay [flags]
+
+Replays the records of the dead letter topic: every record in the range, matching the filters,
+is republished to the topic it failed in, without its dlq.* and retry.* headers and with a
+replay.source header telling where it was replayed from, or passed to the handler like a
+consumed record. Exits with a non-zero status if records failed to be handled.
+
+flags:`
+
+// runReplayCommand runs the "replay" command and returns the process exit code
+func runReplayCommand(args []string) int {
+	ro := consumer.ReplayOptions{
+		From: config.Offset{Position: config.OffsetEarliest},
+		To:   config.Offset{Position: config.OffsetLatest},
+	}
+
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.StringVar(&ro.Topic, "topic", "", "dead letter topic to replay (default MESSAGE_QUEUE_DLQ_TOPIC)")
+	flags.Func("from", "offset to replay every partition from, included: earliest, an RFC 3339 timestamp or an exact offset (default earliest)",
+		func(val string) error { return ro.From.UnmarshalText([]byte(val)) })
+	flags.Func("to", "offset to replay every partition to, excluded: latest, an RFC 3339 timestamp or an exact offset (default latest)",
+		func(val string) error { return ro.To.UnmarshalText([]byte(val)) })
+	flags.Func("filter", "expression the records must match to be replayed, written like the expression of a routing rule "+
+		`e.g. 'header.dlq.error contains "timeout"' (repeatable)`, func(val string) error {
+		filter, err := router.ParseFilter(val)
+		if err != nil {
+			return err
+		}
+		ro.Filters = append(ro.Filters, filter)
+		return nil
+	})
+	flags.Func("set-header", "<name>=<value> header to set on the replayed records (repeatable)", func(val string) error {
+		name, value, ok := strings.Cut(val, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("%q is not a <name>=<value> header", val)
+		}
+		ro.SetHeaders = append(ro.SetHeaders, kgo.RecordHeader{Key: name, Value: []byte(value)})
+		return nil
+	})
+	flags.Func("remove-header", "header to remove from the replayed records (repeatable)", func(val string) error {
+		ro.RemoveHeaders = append(ro.RemoveHeaders, val)
+		return nil
+	})
+	flags.StringVar(&ro.TargetTopic, "target-topic", "", "topic to republish the records to instead of the topic they failed in")
+	flags.BoolVar(&ro.Handle, "handle", false, "pass the records to the handler instead of republishing them")
+	flags.BoolVar(&ro.DryRun, "dry-run", false, "only log the records that would be replayed")
+	cf := addConfigFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, replayUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+	if ro.Handle && ro.TargetTopic != "" {
+		fmt.Fprintln(os.Stderr, "-handle and -target-topic can't be used together")
+		return 2
+	}
+
+	appConfig, err := cf.load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error initializing the application config: %v\n", err)
+		return 1
+	}
+
+	log := logger.New("main")
+
+	err = consumer.Replay(appConfig, consumer.Options{Handlers: handlers}, ro)
+	if err != nil {
+		log.Error("replay error", "error", err.Error())
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/rodney-b/swish-test-consumer/internal/app/consumer"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/logger"
+	"github.com/rodney-b/swish-test-consumer/pkg/utilities/env"
+)
+
+const runUsage = `usage: consumer [run] [flags]
+
+Consumes the configured topics until interrupted.
+
+flags:`
+
+// runRunCommand runs the "run" command and returns the process exit code
+func runRunCommand(args []string) int {
+	opts := consumer.Options{Handlers: handlers}
+
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.TextVar(&opts.SeekToTimestamp, "seek-to-timestamp", time.Time{},
+		"RFC 3339 timestamp to move the group offsets to before consuming, to reprocess the records produced since then. "+
+			"The group must have no active members.")
+	flags.Func("assign", "comma-separated <topic>/<partition>=<offset> partitions to consume without joining the group, "+
+		"where offset is earliest, latest, an RFC 3339 timestamp or an exact offset", func(val string) error {
+		err := env.Set(reflect.ValueOf(&opts.Assignments).Elem(), val)
+		if err != nil {
+			return err
+		}
+		_, err = config.Assignments(opts.Assignments)
+		return err
+	})
+	cf := addConfigFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, runUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	appConfig, err := cf.load()
+	if err != nil {
+		errLog := slog.New(slog.NewJSONHandler(os.Stdout, nil)).With("package", "main")
+		errLog.Error("error initializing the application config", "error", err.Error())
+		return 1
+	}
+
+	log := logger.New("main")
+
+	err = consumer.Run(appConfig, opts)
+	if err != nil {
+		log.Error("consumer error", "error", err.Error())
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/kafka"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/router"
+)
+
+const tailUsage = `usage: consumer tail [flags]
+
+Prints the records of the consumed topics (and their retry topics) without joining the group or
+committing offsets, until interrupted or -n records are printed.
+
+flags:`
+
+// runTailCommand runs the "tail" command and returns the process exit code
+func runTailCommand(args []string) int {
+	from := config.Offset{Position: config.OffsetLatest}
+	var filters []router.Filter
+
+	flags := flag.NewFlagSet("tail", flag.ContinueOnError)
+	flags.Func("from", "offset to print every partition from: earliest, latest, an RFC 3339 timestamp or an exact offset (default latest)",
+		func(val string) error { return from.UnmarshalText([]byte(val)) })
+	count := flags.Int("n", 0, "number of records to print before exiting, or 0 to print records until interrupted")
+	output := flags.String("output", "text", "output format: text or json (one record per line)")
+	flags.Func("filter", "expression the records must match to be printed, written like the expression of a routing rule (repeatable)",
+		func(val string) error {
+			filter, err := router.ParseFilter(val)
+			if err != nil {
+				return err
+			}
+			filters = append(filters, filter)
+			return nil
+		})
+	cf := addConfigFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, tailUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var printRecord func(io.Writer, *kgo.Record) error
+	switch *output {
+	case "text":
+		printRecord = printRecordText
+	case "json":
+		printRecord = printRecordJSON
+	default:
+		fmt.Fprintf(os.Stderr, "unknown output format %q\n", *output)
+		return 2
+	}
+
+	appConfig, err := cf.load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error initializing the application config: %v\n", err)
+		return 1
+	}
+
+	ctx, ctxCancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	defer ctxCancel()
+
+	err = tail(ctx, appConfig, from, *count, func(r *kgo.Record) error {
+		for _, filter := range filters {
+			if !filter.Match(r) {
+				return nil
+			}
+		}
+		return printRecord(os.Stdout, r)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error tailing records: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// tail passes the records of every partition of the consumed topics, from offset from, to fn
+// until ctx is done or count records are passed, if count is positive
+func tail(ctx context.Context, cp config.ConfigProvider, from config.Offset, count int, fn func(*kgo.Record) error) error {
+	adm, err := kafka.NewAdminClient(ctx, cp)
+	if err != nil {
+		return errors.Join(errors.New("error creating kafka admin client"), err)
+	}
+	defer adm.Close()
+
+	topics, err := kafka.ConsumedTopics(ctx, adm, cp)
+	if err != nil {
+		return err
+	}
+	// listing the offsets of no topics lists every topic of the cluster
+	if len(topics) == 0 {
+		return errors.New("no consumed topics to tail")
+	}
+	listed, err := adm.ListEndOffsets(ctx, topics...)
+	if err == nil {
+		err = listed.Error()
+	}
+	if err != nil {
+		return errors.Join(errors.New("failed to list the partitions of the consumed topics"), err)
+	}
+
+	assignments := map[string]config.Offset{}
+	listed.Each(func(l kadm.ListedOffset) {
+		assignments[fmt.Sprintf("%s/%d", l.Topic, l.Partition)] = from
+	})
+	if len(assignments) == 0 {
+		return fmt.Errorf("no partitions to tail in topics %v", topics)
+	}
+
+	kafkaClient, err := kafka.NewClient(ctx, cp, kafka.WithAssignments(assignments))
+	if err != nil {
+		return errors.Join(errors.New("error creating kafka client"), err)
+	}
+	defer kafkaClient.Close()
+
+	passed := 0
+	for {
+		fetches := kafkaClient.PollFetches(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		var errs []error
+		fetches.EachError(func(topic string, partition int32, err error) {
+			errs = append(errs, fmt.Errorf("error fetching %s/%d: %w", topic, partition, err))
+		})
+		if len(errs) > 0 {
+			return errors.Join(errs...)
+		}
+
+		for iter := fetches.RecordIter(); !iter.Done(); {
+			if err := fn(iter.Next()); err != nil {
+				return err
+			}
+			passed++
+			if count > 0 && passed >= count {
+				return nil
+			}
+		}
+	}
+}
+
+// printRecordText prints r on a line as
+// <topic>/<partition>/<offset> <timestamp> key=<key> [<header>=<value> ...] <value>
+func printRecordText(w io.Writer, r *kgo.Record) error {
+	headers := make([]string, 0, len(r.Headers))
+	for _, h := range r.Headers {
+		headers = append(headers, h.Key+"="+string(h.Value))
+	}
+
+	_, err := fmt.Fprintf(w, "%s/%d/%d %s key=%s [%s] %s\n", r.Topic, r.Partition, r.Offset,
+		r.Timestamp.Format(time.RFC3339Nano), r.Key, strings.Join(headers, " "), r.Value)
+	return err
+}
+
+// printRecordJSON prints r as a JSON object on a line
+func printRecordJSON(w io.Writer, r *kgo.Record) error {
+	headers := make(map[string]string, len(r.Headers))
+	for _, h := range r.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+
+	return json.NewEncoder(w).Encode(struct {
+		Topic     string            `json:"topic"`
+		Partition int32             `json:"partition"`
+		Offset    int64             `json:"offset"`
+		Timestamp time.Time         `json:"timestamp"`
+		Key       string            `json:"key"`
+		Headers   map[string]string `json:"headers"`
+		Value     string            `json:"value"`
+	}{
+		Topic:     r.Topic,
+		Partition: r.Partition,
+		Offset:    r.Offset,
+		Timestamp: r.Timestamp,
+		Key:       string(r.Key),
+		Headers:   headers,
+		Value:     string(r.Value),
+	})
+}
@@ -0,0 +1,363 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/handler"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/kafka"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/telemetry"
+)
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// batches are the records polled, grouped per partition in the order the partitions were polled
+type batches struct {
+	order   []topicPartition
+	records map[topicPartition][]*kgo.Record
+}
+
+func newBatches() *batches {
+	return &batches{records: make(map[topicPartition][]*kgo.Record)}
+}
+
+// add adds the records of fetches and reports whether a partition has at least size records
+func (b *batches) add(fetches kgo.Fetches, size int) (full bool) {
+	fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+		if len(p.Records) == 0 {
+			return
+		}
+
+		tp := topicPartition{topic: p.Topic, partition: p.Partition}
+		if _, ok := b.records[tp]; !ok {
+			b.order = append(b.order, tp)
+		}
+		b.records[tp] = append(b.records[tp], p.Records...)
+		full = full || len(b.records[tp]) >= size
+	})
+
+	return full
+}
+
+func (b *batches) empty() bool {
+	return len(b.order) == 0
+}
+
+// last returns the last record of every partition, which are committed once handled
+func (b *batches) last() []*kgo.Record {
+	var last []*kgo.Record
+	for _, tp := range b.order {
+		if records := b.records[tp]; len(records) > 0 {
+			last = append(last, records[len(records)-1])
+		}
+	}
+	return last
+}
+
+// delayedRetries holds back the records of retry topics that aren't due yet. Their partition is
+// paused until the first of them is due, then they're handed back to be handled, followed by the
+// records fetched once the partition is resumed. Retry topics are filled in order, so the records
+// after the first one not due aren't due either.
+type delayedRetries struct {
+	log *slog.Logger
+
+	mu      sync.Mutex
+	records map[topicPartition][]*kgo.Record
+	timers  map[topicPartition]*time.Timer
+	due     map[topicPartition]bool
+}
+
+func newDelayedRetries(log *slog.Logger) *delayedRetries {
+	return &delayedRetries{
+		log:     log,
+		records: make(map[topicPartition][]*kgo.Record),
+		timers:  make(map[topicPartition]*time.Timer),
+		due:     make(map[topicPartition]bool),
+	}
+}
+
+// apply hands the records held back that are due to b, ahead of the records polled since, and
+// holds back the records of b that aren't due, pausing their partition until they are
+func (d *delayedRetries) apply(client *kgo.Client, b *batches, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for tp, held := range d.records {
+		// polling stops when they're due, possibly right before their timer fires
+		if notBefore, _ := kafka.RetryNotBefore(held[0]); !d.due[tp] && notBefore.After(now) {
+			continue
+		}
+		if !d.due[tp] {
+			client.ResumeFetchPartitions(map[string][]int32{tp.topic: {tp.partition}})
+		}
+		if _, ok := b.records[tp]; !ok {
+			b.order = append(b.order, tp)
+		}
+		b.records[tp] = append(held, b.records[tp]...)
+		d.forget(tp)
+	}
+
+	for _, tp := range b.order {
+		records := b.records[tp]
+		i := slices.IndexFunc(records, func(r *kgo.Record) bool {
+			notBefore, ok := kafka.RetryNotBefore(r)
+			return ok && notBefore.After(now)
+		})
+		if i < 0 {
+			continue
+		}
+
+		r := records[i]
+		notBefore, _ := kafka.RetryNotBefore(r)
+		d.records[tp] = slices.Clone(records[i:])
+		b.records[tp] = records[:i]
+
+		// the records buffered for a paused partition are dropped without moving its fetch
+		// offset, so fetching resumes right after the records held back
+		partitions := map[string][]int32{tp.topic: {tp.partition}}
+		client.PauseFetchPartitions(partitions)
+		var timer *time.Timer
+		timer = time.AfterFunc(notBefore.Sub(now), func() {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			if d.timers[tp] != timer {
+				return
+			}
+			d.due[tp] = true
+			client.ResumeFetchPartitions(partitions)
+		})
+		d.timers[tp] = timer
+
+		d.log.Debug("retry partition paused until due", "topic", tp.topic, "partition", tp.partition,
+			"offset", r.Offset, "notBefore", notBefore)
+	}
+}
+
+// nextDue returns when the first records held back are due, or the zero time if none are
+func (d *delayedRetries) nextDue() time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var next time.Time
+	for _, held := range d.records {
+		notBefore, _ := kafka.RetryNotBefore(held[0])
+		if next.IsZero() || notBefore.Before(next) {
+			next = notBefore
+		}
+	}
+	return next
+}
+
+// revoke drops the records held back for partitions, which are consumed from their committed
+// offset by the group member they're assigned to, and resumes fetching them in case they're
+// assigned back
+func (d *delayedRetries) revoke(client *kgo.Client, partitions map[string][]int32) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	resumed := make(map[string][]int32)
+	for topic, ps := range partitions {
+		for _, p := range ps {
+			tp := topicPartition{topic: topic, partition: p}
+			if _, ok := d.timers[tp]; ok {
+				d.forget(tp)
+				resumed[topic] = append(resumed[topic], p)
+			}
+		}
+	}
+	if len(resumed) > 0 {
+		client.ResumeFetchPartitions(resumed)
+	}
+}
+
+// stop stops the timers resuming the paused partitions, once the client is closed
+func (d *delayedRetries) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for tp := range d.timers {
+		d.forget(tp)
+	}
+}
+
+// forget stops the timer of tp and drops its records held back. d.mu must be held.
+func (d *delayedRetries) forget(tp topicPartition) {
+	d.timers[tp].Stop()
+	delete(d.timers, tp)
+	delete(d.records, tp)
+	delete(d.due, tp)
+}
+
+// handle passes the records of every partition to bh in batches of up to size records, and
+// returns the records that failed
+func (b *batches) handle(ctx context.Context, bh handler.BatchHandler, size int) []handler.Failure {
+	var failures []handler.Failure
+	for _, tp := range b.order {
+		records := b.records[tp]
+		for start := 0; start < len(records); start += size {
+			batch := records[start:min(start+size, len(records))]
+			failures = append(failures, handler.Failures(batch, bh.HandleBatch(ctx, batch))...)
+		}
+	}
+
+	return failures
+}
+
+// batcher collects the polled records of every partition until they're ready to be handled:
+// once the partition has a full batch, or the batch timeout elapsed since its first record was
+// polled. The records of the partitions that aren't ready are kept for the next polls, so every
+// partition waits for its own batch timeout.
+type batcher struct {
+	// wait is set to wait for full batches, instead of handling the records once polled
+	wait bool
+
+	mu      sync.Mutex
+	pending *batches
+	since   map[topicPartition]time.Time
+}
+
+func newBatcher(wait bool) *batcher {
+	return &batcher{wait: wait, pending: newBatches(), since: make(map[topicPartition]time.Time)}
+}
+
+// poll polls until a partition is ready, or ctx is done, and returns the records of the
+// partitions ready to be handled
+func (bt *batcher) poll(ctx context.Context, client *kgo.Client, conf config.HandlerConfig, log *slog.Logger) *batches {
+	for {
+		now := time.Now()
+		ready, deadline := bt.take(now, conf)
+		if !ready.empty() || ctx.Err() != nil {
+			return ready
+		}
+
+		pollCtx, cancel := ctx, context.CancelFunc(func() {})
+		if !deadline.IsZero() {
+			pollCtx, cancel = context.WithDeadline(ctx, deadline)
+		}
+		fetches := client.PollFetches(pollCtx)
+		cancel()
+
+		fetches.EachError(func(topic string, partition int32, err error) {
+			// injected when the poll deadline elapses
+			if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+				return
+			}
+			log.Error("fetch error", "topic", topic, "partition", partition, "error", err)
+		})
+
+		bt.add(fetches, time.Now())
+	}
+}
+
+// add adds the records of fetches to the pending partitions, polled at now
+func (bt *batcher) add(fetches kgo.Fetches, now time.Time) {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+
+	fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+		tp := topicPartition{topic: p.Topic, partition: p.Partition}
+		if _, ok := bt.since[tp]; !ok && len(p.Records) > 0 {
+			bt.since[tp] = now
+		}
+	})
+	bt.pending.add(fetches, 0)
+}
+
+// take removes the partitions ready to be handled at now from the pending partitions and returns
+// them, with the time the next pending partition is ready, if any
+func (bt *batcher) take(now time.Time, conf config.HandlerConfig) (ready *batches, next time.Time) {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+
+	ready = newBatches()
+	for _, tp := range slices.Clone(bt.pending.order) {
+		deadline := bt.since[tp].Add(conf.BatchTimeout)
+		if !bt.wait || len(bt.pending.records[tp]) >= conf.BatchSize || !now.Before(deadline) {
+			ready.order = append(ready.order, tp)
+			ready.records[tp] = bt.pending.records[tp]
+			bt.remove(tp)
+			continue
+		}
+		if next.IsZero() || deadline.Before(next) {
+			next = deadline
+		}
+	}
+
+	return ready, next
+}
+
+// revoke drops the pending records of partitions, which are consumed from their committed offset
+// by the group member they're assigned to
+func (bt *batcher) revoke(partitions map[string][]int32) {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+
+	for topic, ps := range partitions {
+		for _, p := range ps {
+			bt.remove(topicPartition{topic: topic, partition: p})
+		}
+	}
+}
+
+// remove removes tp from the pending partitions. bt.mu must be held.
+func (bt *batcher) remove(tp topicPartition) {
+	bt.pending.order = slices.DeleteFunc(bt.pending.order, func(o topicPartition) bool { return o == tp })
+	delete(bt.pending.records, tp)
+	delete(bt.since, tp)
+}
+
+// batchHandler returns the batch handler of opts, or its per-record handler adapted to batches
+func batchHandler(opts Options) handler.BatchHandler {
+	if opts.BatchHandler != nil {
+		return opts.BatchHandler
+	}
+	return handler.PerRecord(opts.Handler)
+}
+
+// Outcomes of the records that failed
+const (
+	outcomeRetried      = "retried"
+	outcomeDeadLettered = "dead_lettered"
+	outcomeSkipped      = "skipped"
+)
+
+// handleFailures logs and counts the records that failed, and emits them to their next retry
+// topic or, once retried after every retry delay, to the dead letter topic of the config, if any
+func handleFailures(ctx context.Context, cp config.ConfigProvider, emitter handler.Emitter, failures []handler.Failure, log *slog.Logger, tel *telemetry.Telemetry) error {
+	options := cp.GetMessageQueueOptions()
+
+	var errs []error
+	for _, f := range failures {
+		r := f.Record
+
+		outcome := outcomeSkipped
+		var redirect *kgo.Record
+		if retry, ok := kafka.NextRetry(r, options.RetryDelays, f.Err, time.Now()); ok {
+			outcome, redirect = outcomeRetried, retry
+		} else if options.DLQTopic != "" {
+			outcome, redirect = outcomeDeadLettered, kafka.DeadLetter(options.DLQTopic, r, f.Err)
+		}
+
+		log.Error("error handling record", "topic", r.Topic, "partition", r.Partition, "offset", r.Offset,
+			"outcome", outcome, "error", f.Err.Error())
+		tel.IncrementFailureCounter(ctx, kafka.OriginTopic(r), outcome)
+
+		if redirect != nil {
+			if err := emitter.Emit(ctx, redirect); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,448 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/handler"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/kafka"
+)
+
+// newTestClient returns a client that's never connected, to pause and resume partitions
+func newTestClient(t *testing.T) *kgo.Client {
+	t.Helper()
+
+	client, err := kgo.NewClient(kgo.SeedBrokers("localhost:1"), kgo.ConsumeTopics("orders"))
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	t.Cleanup(client.Close)
+
+	return client
+}
+
+// record returns the record of topic/partition at offset, due at notBefore unless it's zero
+func record(topic string, partition int32, offset int64, notBefore time.Time) *kgo.Record {
+	r := &kgo.Record{Topic: topic, Partition: partition, Offset: offset}
+	if !notBefore.IsZero() {
+		r.Headers = append(r.Headers, kgo.RecordHeader{
+			Key:   kafka.RetryNotBeforeHeader,
+			Value: []byte(strconv.FormatInt(notBefore.UnixMilli(), 10)),
+		})
+	}
+	return r
+}
+
+// polledFetches returns the fetches of records, fetched one by one
+func polledFetches(records ...*kgo.Record) kgo.Fetches {
+	var fetches kgo.Fetches
+	for _, r := range records {
+		fetches = append(fetches, kgo.Fetch{Topics: []kgo.FetchTopic{{
+			Topic:      r.Topic,
+			Partitions: []kgo.FetchPartition{{Partition: r.Partition, Records: []*kgo.Record{r}}},
+		}}})
+	}
+	return fetches
+}
+
+// polled returns the batches of records, as if they were polled one by one
+func polled(size int, records ...*kgo.Record) *batches {
+	b := newBatches()
+	b.add(polledFetches(records...), size)
+	return b
+}
+
+// offsets returns the offsets of the records of b for topic/partition
+func offsets(b *batches, topic string, partition int32) []int64 {
+	var offsets []int64
+	for _, r := range b.records[topicPartition{topic: topic, partition: partition}] {
+		offsets = append(offsets, r.Offset)
+	}
+	return offsets
+}
+
+func TestBatchesAdd(t *testing.T) {
+	tests := []struct {
+		name     string
+		records  []*kgo.Record
+		size     int
+		wantFull bool
+	}{
+		{name: "no records", size: 2},
+		{name: "partial batches", records: []*kgo.Record{record("orders", 0, 0, time.Time{}), record("orders", 1, 0, time.Time{})}, size: 2},
+		{name: "full batch", records: []*kgo.Record{record("orders", 0, 0, time.Time{}), record("orders", 1, 0, time.Time{}), record("orders", 0, 1, time.Time{})}, size: 2, wantFull: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBatches()
+			var full bool
+			for _, r := range tt.records {
+				full = b.add(polledFetches(r), tt.size)
+			}
+			if full != tt.wantFull {
+				t.Fatalf("expected full = %v but got %v", tt.wantFull, full)
+			}
+			if b.empty() != (len(tt.records) == 0) {
+				t.Fatalf("expected empty = %v but got %v", len(tt.records) == 0, b.empty())
+			}
+		})
+	}
+}
+
+func TestBatchesHandle(t *testing.T) {
+	b := polled(2,
+		record("orders", 0, 0, time.Time{}), record("orders", 1, 0, time.Time{}),
+		record("orders", 0, 1, time.Time{}), record("orders", 0, 2, time.Time{}),
+	)
+
+	var batches [][]int64
+	failures := b.handle(context.Background(), handler.BatchFunc(func(_ context.Context, records []*kgo.Record) error {
+		var batch []int64
+		for _, r := range records {
+			batch = append(batch, int64(r.Partition)*100+r.Offset)
+		}
+		batches = append(batches, batch)
+
+		if records[0].Partition == 1 {
+			return errors.New("partition unavailable")
+		}
+		batchErr := &handler.BatchError{}
+		for _, r := range records {
+			if r.Offset == 2 {
+				batchErr.Fail(r, errors.New("invalid record"))
+			}
+		}
+		return batchErr.Err()
+	}), 2)
+
+	// batches of up to 2 records of a partition, in the order the partitions were polled
+	want := [][]int64{{0, 1}, {2}, {100}}
+	if !slices.EqualFunc(batches, want, slices.Equal) {
+		t.Fatalf("expected batches %v but got %v", want, batches)
+	}
+
+	var failed []int64
+	for _, f := range failures {
+		failed = append(failed, int64(f.Record.Partition)*100+f.Record.Offset)
+	}
+	if !slices.Equal(failed, []int64{2, 100}) {
+		t.Fatalf("expected the records 2 and 100 to fail but got %v", failed)
+	}
+}
+
+func TestBatcherTake(t *testing.T) {
+	start := time.Now()
+	conf := config.HandlerConfig{BatchSize: 3, BatchTimeout: 200 * time.Millisecond}
+
+	tests := []struct {
+		name     string
+		wait     bool
+		at       time.Duration
+		want     []string
+		wantNext time.Duration
+	}{
+		{name: "handled once polled without waiting", at: 0, want: []string{"orders/0", "orders/1", "orders/2"}},
+		{name: "full partition", wait: true, at: 100 * time.Millisecond, want: []string{"orders/2"}, wantNext: 200 * time.Millisecond},
+		{name: "first partition timed out", wait: true, at: 200 * time.Millisecond, want: []string{"orders/0", "orders/2"}, wantNext: 350 * time.Millisecond},
+		{name: "every partition timed out", wait: true, at: 350 * time.Millisecond, want: []string{"orders/0", "orders/1", "orders/2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bt := newBatcher(tt.wait)
+			// partition 1 is polled 150ms after the others
+			bt.add(polledFetches(record("orders", 0, 0, time.Time{}), record("orders", 2, 0, time.Time{}),
+				record("orders", 2, 1, time.Time{}), record("orders", 2, 2, time.Time{})), start)
+			bt.add(polledFetches(record("orders", 1, 0, time.Time{})), start.Add(150*time.Millisecond))
+
+			ready, next := bt.take(start.Add(tt.at), conf)
+
+			var got []string
+			for _, tp := range ready.order {
+				got = append(got, fmt.Sprintf("%s/%d", tp.topic, tp.partition))
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("expected the partitions %v to be ready but got %v", tt.want, got)
+			}
+			if wantNext := start.Add(tt.wantNext); (tt.wantNext == 0 && !next.IsZero()) || (tt.wantNext != 0 && !next.Equal(wantNext)) {
+				t.Fatalf("expected the next partition to be ready at %s but got %s", wantNext, next)
+			}
+			for _, tp := range ready.order {
+				if _, ok := bt.pending.records[tp]; ok {
+					t.Fatalf("expected the ready partition %v not to be pending", tp)
+				}
+			}
+		})
+	}
+}
+
+func TestBatcherRevoke(t *testing.T) {
+	start := time.Now()
+	conf := config.HandlerConfig{BatchSize: 10, BatchTimeout: time.Second}
+
+	bt := newBatcher(true)
+	bt.add(polledFetches(record("orders", 0, 0, time.Time{}), record("orders", 1, 0, time.Time{})), start)
+	bt.revoke(map[string][]int32{"orders": {0}})
+
+	ready, _ := bt.take(start.Add(time.Second), conf)
+	if got := offsets(ready, "orders", 0); len(got) > 0 {
+		t.Fatalf("expected the records of the revoked partition to be dropped but got %v", got)
+	}
+	if got := offsets(ready, "orders", 1); !slices.Equal(got, []int64{0}) {
+		t.Fatalf("expected the records of the other partition to be kept but got %v", got)
+	}
+}
+
+func TestHandleFailures(t *testing.T) {
+	errInvalid := errors.New("invalid record")
+	retried := record("orders.retry.1m", 0, 3, time.Now())
+	retried.Headers = append(retried.Headers,
+		kgo.RecordHeader{Key: kafka.RetryTopicHeader, Value: []byte("orders")},
+		kgo.RecordHeader{Key: kafka.RetryAttemptHeader, Value: []byte("1")},
+	)
+
+	tests := []struct {
+		name      string
+		options   config.KafkaOptions
+		record    *kgo.Record
+		emitErr   error
+		wantTopic string
+		wantErr   bool
+	}{
+		{name: "skipped", record: record("orders", 0, 0, time.Time{})},
+		{name: "dead lettered", options: config.KafkaOptions{DLQTopic: "orders-dlq"}, record: record("orders", 0, 0, time.Time{}), wantTopic: "orders-dlq"},
+		{name: "retried", options: config.KafkaOptions{DLQTopic: "orders-dlq", RetryDelays: []time.Duration{time.Minute}}, record: record("orders", 0, 0, time.Time{}), wantTopic: "orders.retry.1m"},
+		{name: "dead lettered after the retries", options: config.KafkaOptions{DLQTopic: "orders-dlq", RetryDelays: []time.Duration{time.Minute}}, record: retried, wantTopic: "orders-dlq"},
+		{name: "skipped after the retries", options: config.KafkaOptions{RetryDelays: []time.Duration{time.Minute}}, record: retried},
+		{name: "emit error", options: config.KafkaOptions{DLQTopic: "orders-dlq"}, record: record("orders", 0, 0, time.Time{}), emitErr: errors.New("broker unavailable"), wantErr: true},
+	}
+
+	tel := newTestTelemetry(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emitter := &recordingEmitter{err: tt.emitErr}
+			failures := []handler.Failure{{Record: tt.record, Err: errInvalid}}
+
+			err := handleFailures(context.Background(), testConfig{options: tt.options}, emitter, failures, slog.New(slog.DiscardHandler), tel)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var topics []string
+			for _, r := range emitter.emitted {
+				topics = append(topics, r.Topic)
+			}
+			if (tt.wantTopic == "" && len(topics) > 0) || (tt.wantTopic != "" && !slices.Equal(topics, []string{tt.wantTopic})) {
+				t.Fatalf("expected the failed record to be emitted to %q but got %v", tt.wantTopic, topics)
+			}
+		})
+	}
+}
+
+func TestDelayedRetriesApply(t *testing.T) {
+	now := time.Now()
+	due, later, latest := now.Add(-time.Minute), now.Add(time.Minute), now.Add(2*time.Minute)
+
+	tests := []struct {
+		name       string
+		held       []*kgo.Record
+		records    []*kgo.Record
+		want       []int64
+		wantHeld   []int64
+		wantPaused bool
+		wantDue    time.Time
+	}{
+		{
+			name:    "records without due time",
+			records: []*kgo.Record{record("orders.retry.1m", 0, 0, time.Time{}), record("orders.retry.1m", 0, 1, time.Time{})},
+			want:    []int64{0, 1},
+		},
+		{
+			name:    "due records",
+			records: []*kgo.Record{record("orders.retry.1m", 0, 0, due), record("orders.retry.1m", 0, 1, due)},
+			want:    []int64{0, 1},
+		},
+		{
+			name:       "records from the first not due held back",
+			records:    []*kgo.Record{record("orders.retry.1m", 0, 0, due), record("orders.retry.1m", 0, 1, later), record("orders.retry.1m", 0, 2, latest)},
+			want:       []int64{0},
+			wantHeld:   []int64{1, 2},
+			wantPaused: true,
+			wantDue:    later,
+		},
+		{
+			name:       "held back records not due yet",
+			held:       []*kgo.Record{record("orders.retry.1m", 0, 0, later)},
+			want:       nil,
+			wantHeld:   []int64{0},
+			wantPaused: true,
+			wantDue:    later,
+		},
+		{
+			name:    "held back records due handed back ahead of the polled ones",
+			held:    []*kgo.Record{record("orders.retry.1m", 0, 0, now), record("orders.retry.1m", 0, 1, due)},
+			records: []*kgo.Record{record("orders.retry.1m", 0, 2, due)},
+			want:    []int64{0, 1, 2},
+		},
+		{
+			name:       "held back records due held back again from the first not due",
+			held:       []*kgo.Record{record("orders.retry.1m", 0, 0, now), record("orders.retry.1m", 0, 1, latest)},
+			want:       []int64{0},
+			wantHeld:   []int64{1},
+			wantPaused: true,
+			wantDue:    latest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t)
+			d := newDelayedRetries(slog.New(slog.DiscardHandler))
+			defer d.stop()
+
+			// held back when polled a minute ago
+			if len(tt.held) > 0 {
+				d.apply(client, polled(10, tt.held...), now.Add(-2*time.Minute))
+			}
+
+			b := polled(10, tt.records...)
+			d.apply(client, b, now)
+
+			if got := offsets(b, "orders.retry.1m", 0); !slices.Equal(got, tt.want) {
+				t.Fatalf("expected the records %v to be handled but got %v", tt.want, got)
+			}
+			var held []int64
+			for _, r := range d.records[topicPartition{topic: "orders.retry.1m", partition: 0}] {
+				held = append(held, r.Offset)
+			}
+			if !slices.Equal(held, tt.wantHeld) {
+				t.Fatalf("expected the records %v to be held back but got %v", tt.wantHeld, held)
+			}
+			if paused := len(client.PauseFetchPartitions(nil)) > 0; paused != tt.wantPaused {
+				t.Fatalf("expected paused = %v but got %v", tt.wantPaused, paused)
+			}
+			if next := d.nextDue(); !next.Equal(tt.wantDue.Truncate(time.Millisecond)) && !(next.IsZero() && tt.wantDue.IsZero()) {
+				t.Fatalf("expected the next records to be due at %s but got %s", tt.wantDue, next)
+			}
+		})
+	}
+}
+
+func TestDelayedRetriesTimer(t *testing.T) {
+	client := newTestClient(t)
+	d := newDelayedRetries(slog.New(slog.DiscardHandler))
+	defer d.stop()
+
+	now := time.Now()
+	d.apply(client, polled(10, record("orders.retry.1m", 0, 0, now.Add(10*time.Millisecond))), now)
+
+	// the timer resumes the partition once the held back records are due
+	deadline := time.Now().Add(time.Second)
+	for len(client.PauseFetchPartitions(nil)) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the partition to be resumed once due")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// the records fetched once resumed follow the held back ones
+	b := polled(10, record("orders.retry.1m", 0, 1, time.Time{}))
+	d.apply(client, b, time.Now())
+	if got := offsets(b, "orders.retry.1m", 0); !slices.Equal(got, []int64{0, 1}) {
+		t.Fatalf("expected the records [0 1] to be handled but got %v", got)
+	}
+}
+
+func TestDelayedRetriesRevoke(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Minute)
+
+	tests := []struct {
+		name       string
+		revoked    map[string][]int32
+		wantHeld   bool
+		wantPaused bool
+	}{
+		{name: "paused partition revoked", revoked: map[string][]int32{"orders.retry.1m": {0}}},
+		{name: "other partition revoked", revoked: map[string][]int32{"orders.retry.1m": {1}, "orders": {0}}, wantHeld: true, wantPaused: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t)
+			d := newDelayedRetries(slog.New(slog.DiscardHandler))
+			defer d.stop()
+
+			d.apply(client, polled(10, record("orders.retry.1m", 0, 0, later)), now)
+			d.revoke(client, tt.revoked)
+
+			if held := len(d.records) > 0 && len(d.timers) > 0; held != tt.wantHeld {
+				t.Fatalf("expected held back records = %v but got %v", tt.wantHeld, held)
+			}
+			if paused := len(client.PauseFetchPartitions(nil)) > 0; paused != tt.wantPaused {
+				t.Fatalf("expected paused = %v but got %v", tt.wantPaused, paused)
+			}
+			if next := d.nextDue(); next.IsZero() == tt.wantHeld {
+				t.Fatalf("expected the next due time to be set = %v but got %s", tt.wantHeld, next)
+			}
+		})
+	}
+}
+
+// TestBatchesLastHeldBack checks the offsets committed, given by the last record of every
+// partition, never pass the records held back
+func TestBatchesLastHeldBack(t *testing.T) {
+	now := time.Now()
+	due, later := now.Add(-time.Minute), now.Add(time.Minute)
+
+	client := newTestClient(t)
+	d := newDelayedRetries(slog.New(slog.DiscardHandler))
+	defer d.stop()
+
+	b := polled(10,
+		record("orders", 0, 7, time.Time{}),
+		record("orders.retry.1m", 0, 0, due), record("orders.retry.1m", 0, 1, due),
+		record("orders.retry.1m", 0, 2, later), record("orders.retry.1m", 0, 3, later),
+		record("orders.retry.1m", 1, 0, later),
+	)
+	d.apply(client, b, now)
+
+	firstHeld := map[topicPartition]int64{}
+	for tp, held := range d.records {
+		firstHeld[tp] = held[0].Offset
+	}
+
+	last := map[topicPartition]int64{}
+	for _, r := range b.last() {
+		tp := topicPartition{topic: r.Topic, partition: r.Partition}
+		last[tp] = r.Offset
+		if first, ok := firstHeld[tp]; ok && r.Offset >= first {
+			t.Fatalf("expected the offset committed for %s/%d to stay before the held back offset %d but got %d",
+				r.Topic, r.Partition, first, r.Offset)
+		}
+	}
+
+	want := map[topicPartition]int64{
+		{topic: "orders", partition: 0}:          7,
+		{topic: "orders.retry.1m", partition: 0}: 1,
+	}
+	if len(last) != len(want) {
+		t.Fatalf("expected the last records %v but got %v", want, last)
+	}
+	for tp, offset := range want {
+		if last[tp] != offset {
+			t.Fatalf("expected the last records %v but got %v", want, last)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package consumer
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/healthcheck"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/telemetry"
+	"github.com/rodney-b/swish-test-consumer/pkg/certs"
+)
+
+// certMonitor periodically checks when the app's certificates expire. It records the time left
+// for each of them, logs a warning every time one crosses a warning threshold and sets the
+// certificates healthcheck service to NOT_SERVING once any of them has expired.
+type certMonitor struct {
+	cp  config.ConfigProvider
+	log *slog.Logger
+	tel *telemetry.Telemetry
+	// warned holds the smallest threshold already logged for each certificate
+	warned map[string]time.Duration
+}
+
+func newCertMonitor(cp config.ConfigProvider, log *slog.Logger, tel *telemetry.Telemetry) *certMonitor {
+	return &certMonitor{
+		cp:     cp,
+		log:    log,
+		tel:    tel,
+		warned: map[string]time.Duration{},
+	}
+}
+
+// run checks the certificates every check interval until ctx is cancelled
+func (cm *certMonitor) run(ctx context.Context) {
+	ticker := time.NewTicker(cm.cp.GetCertExpiryCheckInterval())
+	defer ticker.Stop()
+
+	for {
+		cm.check(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// monitoredCerts returns the certificates to check, by name. Certificates that aren't set, like
+// the client certificate with server authentication only, or the CA with the system roots, aren't
+// checked. The message queue client certificate is read from the keystore when one is set.
+func (cm *certMonitor) monitoredCerts() map[string]func() ([]certs.CertInfo, error) {
+	monitored := map[string]func() ([]certs.CertInfo, error){}
+	addPEM := func(name string, certPEM []byte) {
+		if len(certPEM) > 0 {
+			monitored[name] = func() ([]certs.CertInfo, error) { return certs.Inspect(certPEM) }
+		}
+	}
+
+	if cm.cp.GetMessageQueueTLSEnabled() {
+		addPEM("message-queue-ca", cm.cp.GetMessageQueueClientCA())
+		if keystore := cm.cp.GetMessageQueueClientP12(); len(keystore) > 0 {
+			password := cm.cp.GetMessageQueueClientCertKeyPassword()
+			monitored["message-queue-client"] = func() ([]certs.CertInfo, error) {
+				return certs.InspectPKCS12(keystore, password)
+			}
+		} else {
+			addPEM("message-queue-client", cm.cp.GetMessageQueueClientCert())
+		}
+	}
+
+	// the consumer certificate is only used by the OTLP exporter
+	if !cm.cp.GetOtelStdoutExporterEnabled() {
+		addPEM("consumer-ca", cm.cp.GetConsumerCA())
+		addPEM("consumer-client", cm.cp.GetConsumerCert())
+	}
+
+	return monitored
+}
+
+func (cm *certMonitor) check(ctx context.Context, now time.Time) {
+	healthcheck.SetCertificatesStatus(cm.inspect(ctx, now))
+}
+
+// inspect records the time left for every certificate, logs the expired and expiring ones and
+// returns the status of the certificates healthcheck service. The warnings of certificates no
+// longer used, once rotated, are forgotten.
+func (cm *certMonitor) inspect(ctx context.Context, now time.Time) healthgrpc.HealthCheckResponse_ServingStatus {
+	status := healthgrpc.HealthCheckResponse_SERVING
+	current := map[string]bool{}
+	var failed []string
+
+	for name, inspect := range cm.monitoredCerts() {
+		infos, err := inspect()
+		if err != nil {
+			failed = append(failed, name)
+			cm.log.Error("error inspecting certificate", "certificate", name, "error", err.Error())
+			continue
+		}
+
+		for _, info := range infos {
+			cm.tel.RecordCertificateExpiry(ctx, name, info)
+			current[warnedKey(name, info)] = true
+
+			if info.Expired(now) {
+				status = healthgrpc.HealthCheckResponse_NOT_SERVING
+				cm.log.Error("certificate expired",
+					"certificate", name,
+					"subject", info.Subject,
+					"serialNumber", info.SerialNumber,
+					"notAfter", info.NotAfter)
+				continue
+			}
+
+			cm.warnIfExpiring(name, info, now)
+		}
+	}
+
+	// the certificates that couldn't be inspected keep their warnings
+	maps.DeleteFunc(cm.warned, func(key string, _ time.Duration) bool {
+		return !current[key] && !slices.ContainsFunc(failed, func(name string) bool {
+			return strings.HasPrefix(key, name+"/")
+		})
+	})
+
+	return status
+}
+
+// warnedKey returns the key of the certificate in the warned thresholds
+func warnedKey(name string, info certs.CertInfo) string {
+	return name + "/" + info.Subject + "/" + info.SerialNumber
+}
+
+// warnIfExpiring logs a warning the first time the certificate is found to expire within a threshold
+func (cm *certMonitor) warnIfExpiring(name string, info certs.CertInfo, now time.Time) {
+	untilExpiry := info.UntilExpiry(now)
+	key := warnedKey(name, info)
+
+	thresholds := slices.Clone(cm.cp.GetCertExpiryWarningThresholds())
+	slices.Sort(thresholds)
+
+	for _, threshold := range thresholds {
+		if untilExpiry > threshold {
+			continue
+		}
+
+		if warned, ok := cm.warned[key]; ok && warned <= threshold {
+			return
+		}
+
+		cm.warned[key] = threshold
+		cm.log.Warn("certificate expiring soon",
+			"certificate", name,
+			"subject", info.Subject,
+			"serialNumber", info.SerialNumber,
+			"notAfter", info.NotAfter,
+			"threshold", threshold.String())
+		return
+	}
+}
@@ -0,0 +1,130 @@
+package consumer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"log/slog"
+	"maps"
+	"math/big"
+	"slices"
+	"testing"
+	"time"
+
+	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/rodney-b/swish-test-consumer/pkg/certs"
+)
+
+// certConfig provides the certificates of the config, warned about a day before they expire
+type certConfig struct {
+	testConfig
+	plaintext                bool
+	caPEM, certPEM, keystore []byte
+}
+
+func (cc certConfig) GetCertExpiryWarningThresholds() []time.Duration {
+	return []time.Duration{24 * time.Hour}
+}
+
+func (cc certConfig) GetMessageQueueTLSEnabled() bool              { return !cc.plaintext }
+func (cc certConfig) GetMessageQueueClientCA() []byte              { return cc.caPEM }
+func (cc certConfig) GetMessageQueueClientCert() []byte            { return cc.certPEM }
+func (cc certConfig) GetMessageQueueClientP12() []byte             { return cc.keystore }
+func (cc certConfig) GetMessageQueueClientCertKeyPassword() string { return "changeit" }
+
+func TestMonitoredCerts(t *testing.T) {
+	tests := []struct {
+		name string
+		cc   certConfig
+		want []string
+		// wantKeystore is true if the client certificate is read from the keystore
+		wantKeystore bool
+	}{
+		{name: "mutual TLS", cc: certConfig{caPEM: []byte("ca"), certPEM: []byte("cert")}, want: []string{"message-queue-ca", "message-queue-client"}},
+		{name: "server authentication only", cc: certConfig{caPEM: []byte("ca")}, want: []string{"message-queue-ca"}},
+		{name: "system roots", cc: certConfig{certPEM: []byte("cert")}, want: []string{"message-queue-client"}},
+		{name: "keystore", cc: certConfig{caPEM: []byte("ca"), certPEM: []byte("cert"), keystore: []byte("p12")}, want: []string{"message-queue-ca", "message-queue-client"}, wantKeystore: true},
+		{name: "no certificates"},
+		{name: "no TLS", cc: certConfig{plaintext: true, caPEM: []byte("ca"), certPEM: []byte("cert")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := newCertMonitor(tt.cc, nil, nil)
+
+			monitored := cm.monitoredCerts()
+			got := slices.Sorted(maps.Keys(monitored))
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("expected certificates %v but got %v", tt.want, got)
+			}
+
+			if tt.wantKeystore {
+				if _, err := monitored["message-queue-client"](); !errors.Is(err, certs.ErrParsePKCS12Fail) {
+					t.Fatalf("expected the keystore to be inspected but got %v", err)
+				}
+			}
+		})
+	}
+}
+
+// testCertPEM returns a self-signed certificate with serial, expiring at notAfter
+func testCertPEM(t *testing.T, serial int64, notAfter time.Time) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "consumer"},
+		NotBefore:    notAfter.Add(-48 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestCertMonitorInspect(t *testing.T) {
+	tel := newTestTelemetry(t)
+	now := time.Now()
+	expiring := testCertPEM(t, 1, now.Add(time.Hour))
+	rotated := testCertPEM(t, 2, now.Add(90*24*time.Hour))
+
+	tests := []struct {
+		name       string
+		certPEM    []byte
+		wantStatus healthgrpc.HealthCheckResponse_ServingStatus
+		wantWarned []string
+	}{
+		{name: "expiring", certPEM: expiring, wantStatus: healthgrpc.HealthCheckResponse_SERVING, wantWarned: []string{"message-queue-client/CN=consumer/1"}},
+		{name: "invalid keeps the warnings", certPEM: []byte("invalid"), wantStatus: healthgrpc.HealthCheckResponse_SERVING, wantWarned: []string{"message-queue-client/CN=consumer/1"}},
+		{name: "rotated forgets the warnings", certPEM: rotated, wantStatus: healthgrpc.HealthCheckResponse_SERVING},
+		{name: "expired", certPEM: testCertPEM(t, 3, now.Add(-time.Hour)), wantStatus: healthgrpc.HealthCheckResponse_NOT_SERVING},
+	}
+
+	// the monitor is shared, so every check follows the previous one
+	cm := newCertMonitor(certConfig{}, slog.New(slog.DiscardHandler), tel)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm.cp = certConfig{certPEM: tt.certPEM}
+
+			if status := cm.inspect(context.Background(), now); status != tt.wantStatus {
+				t.Fatalf("expected status %s but got %s", tt.wantStatus, status)
+			}
+			if warned := slices.Sorted(maps.Keys(cm.warned)); !slices.Equal(warned, tt.wantWarned) {
+				t.Fatalf("expected warnings for %v but got %v", tt.wantWarned, warned)
+			}
+		})
+	}
+}
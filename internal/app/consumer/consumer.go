@@ -7,18 +7,44 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/twmb/franz-go/pkg/kgo"
 	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
 
 	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/dedup"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/handler"
 	"github.com/rodney-b/swish-test-consumer/internal/pkg/healthcheck"
 	"github.com/rodney-b/swish-test-consumer/internal/pkg/kafka"
 	"github.com/rodney-b/swish-test-consumer/internal/pkg/logger"
 	"github.com/rodney-b/swish-test-consumer/internal/pkg/telemetry"
 )
 
-func Run(cp config.ConfigProvider) error {
+// Options are the startup options of the consumer that aren't part of the config
+type Options struct {
+	// SeekToTimestamp, if set, moves the group offsets to this time before consuming
+	// (see kafka.SeekGroupToTimestamp)
+	SeekToTimestamp time.Time
+	// Assignments, if set, consumes these partitions without joining the group, overriding
+	// the assignments of the config (see config.KafkaOptions)
+	Assignments map[string]config.Offset
+	// Handler processes the consumed records. The records are logged and counted by default.
+	Handler handler.Handler
+	// BatchHandler, if set, processes the consumed records in batches instead of Handler
+	// (see config.HandlerConfig)
+	BatchHandler handler.BatchHandler
+	// Handlers are the named handlers the routing rules of the config can route records to
+	// (see router.Rule)
+	Handlers map[string]handler.Handler
+}
+
+// direct reports whether the consumer uses direct partition assignment instead of the group
+func (opts Options) direct(cp config.ConfigProvider) bool {
+	return len(opts.Assignments) > 0 || cp.GetMessageQueueOptions().IsDirect()
+}
+
+func Run(cp config.ConfigProvider, opts Options) error {
 	log := logger.New("consumer")
 
 	err := healthcheck.Start(cp)
@@ -29,16 +55,52 @@ func Run(cp config.ConfigProvider) error {
 	ctx, ctxCancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 	defer ctxCancel()
 
+	configWatcher, err := config.NewWatcher(logger.New("config"))
+	if err != nil {
+		return errors.Join(err, errors.New("error initializing the config watcher"))
+	}
+	cp.Subscribe(func(cp config.ConfigProvider, change config.Change) {
+		if change.Has("LOG_LEVEL") {
+			logger.SetLevel(cp)
+		}
+	})
+
+	go func() {
+		err := configWatcher.Run(ctx)
+		if err != nil {
+			log.Error("config watcher stopped", "error", err.Error())
+		}
+	}()
+
 	tel, err := telemetry.NewTelemetry(ctx, cp, log)
 	if err != nil {
 		return errors.Join(err, errors.New("error initializing telemetry"))
 	}
 	defer tel.Shutdown()
 
+	go newCertMonitor(cp, logger.New("certificates"), tel).run(ctx)
+
 	// Unnecessary for this app since it's not "serving" anything, but here for demonstration purposes
 	healthcheck.SetAppReadinessStatus(healthgrpc.HealthCheckResponse_SERVING)
 
-	err = consume(ctx, cp, log, tel)
+	err = prepareGroup(ctx, cp, opts, log)
+	if err != nil {
+		return errors.Join(errors.New("error preparing the consumer group"), err)
+	}
+
+	opts, dd, err := wrapHandlers(cp, opts, log, tel)
+	if err != nil {
+		return err
+	}
+	if dd != nil {
+		defer dd.Close()
+	}
+
+	if cp.GetMessageQueueOptions().Transactional {
+		err = consumeTransactional(ctx, cp, opts, dd, log, tel)
+	} else {
+		err = consume(ctx, cp, opts, dd, log, tel)
+	}
 	if err != nil {
 		log.Error("error consuming from kafka", "error", err.Error())
 		return errors.Join(errors.New("error consuming from message queue"), err)
@@ -47,40 +109,162 @@ func Run(cp config.ConfigProvider) error {
 	return nil
 }
 
-func consume(ctx context.Context, cp config.ConfigProvider, log *slog.Logger, tel *telemetry.Telemetry) error {
-	kafkaClient, err := kafka.NewClient(ctx, cp)
+// prepareGroup sets the group offsets before the consumer joins the group: it seeks the group
+// when asked to, and commits the configured partition offsets
+func prepareGroup(ctx context.Context, cp config.ConfigProvider, opts Options, log *slog.Logger) error {
+	if opts.direct(cp) {
+		if !opts.SeekToTimestamp.IsZero() {
+			return errors.New("can't seek the group when consuming directly assigned partitions")
+		}
+		return nil
+	}
+	if opts.SeekToTimestamp.IsZero() && len(cp.GetMessageQueueOptions().PartitionOffsets) == 0 {
+		return nil
+	}
+
+	adm, err := kafka.NewAdminClient(ctx, cp)
+	if err != nil {
+		return errors.Join(errors.New("error creating kafka admin client"), err)
+	}
+	defer adm.Close()
+
+	if !opts.SeekToTimestamp.IsZero() {
+		return kafka.SeekGroupToTimestamp(ctx, adm, cp, opts.SeekToTimestamp, log)
+	}
+
+	return kafka.CommitStartOffsets(ctx, adm, cp, log)
+}
+
+// topicCheckInterval is how often the consumed topics are checked for changes. Regex topics
+// only change when the metadata is refreshed, so checking often is cheap.
+const topicCheckInterval = 10 * time.Second
+
+// consume consumes at least once: the records emitted by the handler, and the failed records
+// sent to the dead letter topic, are produced before the offsets of the records handled are
+// committed, and the records are then marked as processed by dd, if not nil
+func consume(ctx context.Context, cp config.ConfigProvider, opts Options, dd *dedup.Deduplicator, log *slog.Logger, tel *telemetry.Telemetry) error {
+	retries := newDelayedRetries(log)
+	defer retries.stop()
+	bt := newBatcher(opts.BatchHandler != nil)
+
+	clientOptions := []kafka.Option{kafka.WithOnRevoked(func(client *kgo.Client, partitions map[string][]int32) {
+		retries.revoke(client, partitions)
+		bt.revoke(partitions)
+	})}
+	if len(opts.Assignments) > 0 {
+		clientOptions = append(clientOptions, kafka.WithAssignments(opts.Assignments))
+	}
+	kafkaClient, err := kafka.NewClient(ctx, cp, clientOptions...)
 	if err != nil {
 		return errors.Join(errors.New("error creating kafka client"), err)
 	}
 	defer kafkaClient.Close()
 
-	if err := kafkaClient.Ping(ctx); err != nil {
-		return errors.Join(errors.New("error pinging kafka client"), err)
+	producer, err := kafka.NewProducer(ctx, cp)
+	if err != nil {
+		return errors.Join(errors.New("error creating kafka producer"), err)
 	}
+	defer producer.Close(context.Background())
 
+	err = startClient(ctx, kafkaClient, cp, opts, log, tel)
+	if err != nil {
+		return err
+	}
+
+	handlerCtx := handler.WithEmitter(ctx, producer)
+	bh := batchHandler(opts)
 	for {
-		fetches := kafkaClient.PollFetches(ctx)
+		// polling stops once records held back are due, even if no records are fetched
+		pollCtx, cancel := ctx, context.CancelFunc(func() {})
+		if due := retries.nextDue(); !due.IsZero() {
+			pollCtx, cancel = context.WithDeadline(ctx, due)
+		}
+		b := bt.poll(pollCtx, kafkaClient, cp.GetHandler(), log)
+		cancel()
 
 		if err := ctx.Err(); err != nil {
 			log.Info("consumer stopped - context cancelled")
 			break
 		}
 
-		if errs := fetches.Errors(); len(errs) > 0 {
-			for _, fErr := range errs {
-				log.Error("fetch error", "topic", fErr.Topic, "partition", fErr.Partition, "error", fErr.Err)
-			}
-			continue
+		retries.apply(kafkaClient, b, time.Now())
+		failures := b.handle(handlerCtx, bh, cp.GetHandler().BatchSize)
+		err := handleFailures(handlerCtx, cp, producer, failures, log, tel)
+		if err != nil {
+			return errors.Join(errors.New("error sending failed records to the retry or dead letter topics"), err)
+		}
+
+		err = commit(ctx, kafkaClient, producer, b.last(), opts.direct(cp))
+		if err != nil && ctx.Err() != nil {
+			log.Info("consumer stopped - context cancelled before the handled records were committed")
+			break
+		}
+		if err != nil {
+			// the uncommitted records are handled again once restarted
+			return err
+		}
+		markProcessed(ctx, dd, log)
+		kafkaClient.AllowRebalance()
+	}
+
+	return nil
+}
+
+// commit flushes the records emitted by the handler, then commits the offsets of the records
+// handled, given by the last record handled of every partition. An emitted record that failed
+// is returned as an error before committing, stopping the consumer. Offsets aren't committed when
+// consuming directly assigned partitions.
+func commit(ctx context.Context, kafkaClient *kgo.Client, producer *kafka.Producer, last []*kgo.Record, direct bool) error {
+	err := producer.Flush(ctx)
+	if err != nil {
+		return errors.Join(errors.New("error producing emitted records"), err)
+	}
+
+	if direct || len(last) == 0 {
+		return nil
+	}
+
+	// the records held back aren't committed, unlike with CommitUncommittedOffsets
+	err = kafkaClient.CommitRecords(ctx, last...)
+	if err != nil {
+		return errors.Join(errors.New("error committing offsets"), err)
+	}
+
+	return nil
+}
+
+// markProcessed marks the records handled as processed once committed. Failing to do so only
+// lets duplicates through, so it isn't fatal.
+func markProcessed(ctx context.Context, dd *dedup.Deduplicator, log *slog.Logger) {
+	if dd == nil {
+		return
+	}
+
+	err := dd.Commit(ctx)
+	if err != nil {
+		log.Error("error marking the handled records as processed", "error", err.Error())
+	}
+}
+
+// startClient follows the topic changes of the client and checks its connection
+func startClient(ctx context.Context, kafkaClient *kgo.Client, cp config.ConfigProvider, opts Options, log *slog.Logger, tel *telemetry.Telemetry) error {
+	cp.Subscribe(func(cp config.ConfigProvider, change config.Change) {
+		// directly assigned partitions don't depend on the topics
+		if change.Has("MESSAGE_QUEUE_TOPICS") && !opts.direct(cp) {
+			kafka.UpdateTopics(kafkaClient, cp, log)
 		}
+	})
 
-		fetches.EachRecord(func(r *kgo.Record) {
-			log.Info("message consumed",
-				"topic", r.Topic,
-				"msg", string(r.Value),
-			)
+	go kafka.TrackTopics(ctx, kafkaClient, topicCheckInterval, log, func(consumed, added, removed []string) {
+		tel.RecordTopicChanges(ctx, consumed, added, removed)
+	})
+
+	if err := kafkaClient.Ping(ctx); err != nil {
+		return errors.Join(errors.New("error pinging kafka client"), err)
+	}
 
-			tel.IncrementMessageCounter(ctx, cp)
-		})
+	if err := kafka.LogBrokerMetadata(ctx, kafkaClient, log); err != nil {
+		log.Warn("error logging kafka broker metadata", "error", err.Error())
 	}
 
 	return nil
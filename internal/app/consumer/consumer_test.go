@@ -0,0 +1,58 @@
+package consumer
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/telemetry"
+)
+
+// testConfig provides the config values the tests set. The others aren't used by the tests.
+type testConfig struct {
+	config.ConfigProvider
+	options config.KafkaOptions
+	handler config.HandlerConfig
+}
+
+func (tc testConfig) GetAppName() string                          { return "consumer-test" }
+func (tc testConfig) GetOtelStdoutExporterEnabled() bool          { return true }
+func (tc testConfig) GetOTelHTTPReceiverURL() string              { return "localhost:4318" }
+func (tc testConfig) GetMessageQueueOptions() config.KafkaOptions { return tc.options }
+func (tc testConfig) GetHandler() config.HandlerConfig            { return tc.handler }
+
+// newTestTelemetry returns telemetry exporting to stdout
+func newTestTelemetry(t *testing.T) *telemetry.Telemetry {
+	t.Helper()
+
+	tel, err := telemetry.NewTelemetry(context.Background(), testConfig{}, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("error creating telemetry: %v", err)
+	}
+	t.Cleanup(tel.Shutdown)
+
+	return tel
+}
+
+// recordingEmitter keeps the records emitted, and fails them with err if set
+type recordingEmitter struct {
+	err error
+
+	mu      sync.Mutex
+	emitted []*kgo.Record
+}
+
+func (e *recordingEmitter) Emit(_ context.Context, r *kgo.Record) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.err != nil {
+		return e.err
+	}
+	e.emitted = append(e.emitted, r)
+	return nil
+}
@@ -0,0 +1,77 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/dedup"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/handler"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/logger"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/router"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/telemetry"
+)
+
+// newLogHandler returns the default handler, logging and counting every record
+func newLogHandler(cp config.ConfigProvider, log *slog.Logger, tel *telemetry.Telemetry) handler.Handler {
+	return handler.Func(func(ctx context.Context, r *kgo.Record) error {
+		log.Info("message consumed",
+			"topic", r.Topic,
+			"msg", string(r.Value),
+		)
+
+		tel.IncrementMessageCounter(ctx, cp)
+		return nil
+	})
+}
+
+// ValidateRoutingRules checks the routing rules of the config are valid, and only route records
+// to the named handlers of opts
+func ValidateRoutingRules(cp config.ConfigProvider, opts Options) error {
+	err := router.CheckRules(cp.GetRoutingRules(), opts.Handlers)
+	if err != nil {
+		return errors.Join(errors.New("invalid config value for routingRules"), err)
+	}
+
+	return nil
+}
+
+// wrapHandlers returns opts with the handlers wrapped by the routing rules and deduplication of
+// the config, and the deduplicator if any, which must be closed once done with. The records are
+// deduplicated before being routed.
+func wrapHandlers(cp config.ConfigProvider, opts Options, log *slog.Logger, tel *telemetry.Telemetry) (Options, *dedup.Deduplicator, error) {
+	if opts.Handler == nil {
+		opts.Handler = newLogHandler(cp, log, tel)
+	}
+
+	rules, err := router.ParseRules(cp.GetRoutingRules())
+	if err != nil {
+		return opts, nil, errors.Join(errors.New("error parsing the routing rules"), err)
+	}
+	if len(rules) > 0 {
+		rt, err := router.New(rules, opts.Handlers, logger.New("router"))
+		if err != nil {
+			return opts, nil, errors.Join(errors.New("error initializing the router"), err)
+		}
+		opts.Handler = rt.Wrap(opts.Handler)
+		if opts.BatchHandler != nil {
+			opts.BatchHandler = rt.WrapBatch(opts.BatchHandler)
+		}
+	}
+
+	dd, err := dedup.FromConfig(cp, logger.New("dedup"))
+	if err != nil {
+		return opts, nil, errors.Join(errors.New("error initializing deduplication"), err)
+	}
+	if dd != nil {
+		opts.Handler = dd.Wrap(opts.Handler)
+		if opts.BatchHandler != nil {
+			opts.BatchHandler = dd.WrapBatch(opts.BatchHandler)
+		}
+	}
+
+	return opts, dd, nil
+}
@@ -0,0 +1,242 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/handler"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/kafka"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/logger"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/router"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/telemetry"
+)
+
+// ReplayOptions select the dead letter records replayed by Replay and where they go
+type ReplayOptions struct {
+	// Topic is the dead letter topic replayed, the configured one by default
+	Topic string
+	// From and To are the offsets, or timestamps, the records of every partition are replayed
+	// from, included, and to, excluded
+	From, To config.Offset
+	// Filters are the expressions the dead letter records must all match to be replayed
+	// (see router.Filter)
+	Filters []router.Filter
+	// SetHeaders are set on the replayed records, replacing the headers of the same name
+	SetHeaders []kgo.RecordHeader
+	// RemoveHeaders are removed from the replayed records
+	RemoveHeaders []string
+	// TargetTopic is the topic the records are republished to instead of the topic they failed in
+	TargetTopic string
+	// Handle passes the records to the handler of Options instead of republishing them
+	Handle bool
+	// DryRun only logs the records that would be replayed
+	DryRun bool
+}
+
+// replayIdleTimeout is how long the replay waits for records before giving up on the partitions
+// not replayed to their end, whose last offsets may be transaction markers rather than records
+const replayIdleTimeout = 10 * time.Second
+
+// replayStats count the dead letter records read by the replay
+type replayStats struct {
+	replayed, filtered, skipped, failed int
+}
+
+// Replay replays the dead letter records in the range of ro: the records are republished to the
+// topic they failed in, with their dead letter and retry headers removed (see kafka.Replay), or
+// passed to the handlers of opts like consumed records. It returns an error if records failed
+// to be handled.
+func Replay(cp config.ConfigProvider, opts Options, ro ReplayOptions) error {
+	log := logger.New("replay")
+
+	ctx, ctxCancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	defer ctxCancel()
+
+	if ro.Topic == "" {
+		ro.Topic = cp.GetMessageQueueOptions().DLQTopic
+	}
+	if ro.Topic == "" {
+		return errors.New("no dead letter topic to replay")
+	}
+
+	adm, err := kafka.NewAdminClient(ctx, cp)
+	if err != nil {
+		return errors.Join(errors.New("error creating kafka admin client"), err)
+	}
+	ranges, err := kafka.OffsetRanges(ctx, adm, ro.Topic, ro.From, ro.To)
+	adm.Close()
+	if err != nil {
+		return err
+	}
+
+	assignments := map[string]config.Offset{}
+	for partition, r := range ranges {
+		if r.Empty() {
+			delete(ranges, partition)
+			continue
+		}
+		assignments[fmt.Sprintf("%s/%d", ro.Topic, partition)] = config.Offset{Position: config.OffsetExact, Exact: r.Start}
+		log.Info("replaying partition", "topic", ro.Topic, "partition", partition, "from", r.Start, "to", r.End)
+	}
+	if len(ranges) == 0 {
+		log.Info("no records to replay", "topic", ro.Topic, "from", ro.From.String(), "to", ro.To.String())
+		return nil
+	}
+
+	tel, err := telemetry.NewTelemetry(ctx, cp, log)
+	if err != nil {
+		return errors.Join(err, errors.New("error initializing telemetry"))
+	}
+	defer tel.Shutdown()
+
+	opts, dd, err := wrapHandlers(cp, opts, log, tel)
+	if err != nil {
+		return err
+	}
+	if dd != nil {
+		defer dd.Close()
+	}
+
+	// records of aborted transactions never failed, and aren't replayed
+	kafkaClient, err := kafka.NewClient(ctx, cp, kafka.WithAssignments(assignments), kafka.WithReadCommitted())
+	if err != nil {
+		return errors.Join(errors.New("error creating kafka client"), err)
+	}
+	defer kafkaClient.Close()
+
+	producer, err := kafka.NewProducer(ctx, cp)
+	if err != nil {
+		return errors.Join(errors.New("error creating kafka producer"), err)
+	}
+	defer producer.Close(context.Background())
+
+	handlerCtx := handler.WithEmitter(ctx, producer)
+	bh := batchHandler(opts)
+	var stats replayStats
+	for len(ranges) > 0 {
+		pollCtx, pollCancel := context.WithTimeout(ctx, replayIdleTimeout)
+		fetches := kafkaClient.PollFetches(pollCtx)
+		pollCancel()
+
+		if err := ctx.Err(); err != nil {
+			log.Info("replay stopped - context cancelled")
+			break
+		}
+		if fetches.NumRecords() == 0 && pollCtx.Err() != nil {
+			log.Warn("no more records to replay - partitions left unfinished", "partitions", slices.Sorted(maps.Keys(ranges)))
+			break
+		}
+
+		var errs []error
+		fetches.EachError(func(topic string, partition int32, err error) {
+			if !errors.Is(err, context.DeadlineExceeded) {
+				errs = append(errs, fmt.Errorf("error fetching %s/%d: %w", topic, partition, err))
+			}
+		})
+		if len(errs) > 0 {
+			return errors.Join(errs...)
+		}
+
+		var records []*kgo.Record
+		fetches.EachRecord(func(r *kgo.Record) {
+			rng, ok := ranges[r.Partition]
+			if !ok || r.Offset >= rng.End {
+				return
+			}
+			if r.Offset >= rng.End-1 {
+				delete(ranges, r.Partition)
+				kafkaClient.PauseFetchPartitions(map[string][]int32{r.Topic: {r.Partition}})
+			}
+
+			replayed, ok := replayRecord(r, ro, &stats, log)
+			if ok {
+				records = append(records, replayed)
+			}
+		})
+		if ro.DryRun || len(records) == 0 {
+			continue
+		}
+
+		if ro.Handle {
+			for _, failure := range handler.Failures(records, bh.HandleBatch(handlerCtx, records)) {
+				stats.failed++
+				log.Error("error handling replayed record", "source", replaySource(failure.Record), "error", failure.Err.Error())
+			}
+		} else {
+			for _, r := range records {
+				if err := producer.Emit(handlerCtx, r); err != nil {
+					return errors.Join(errors.New("error republishing replayed records"), err)
+				}
+			}
+		}
+
+		if err := producer.Flush(ctx); err != nil {
+			return errors.Join(errors.New("error producing replayed records"), err)
+		}
+		markProcessed(ctx, dd, log)
+		stats.replayed += len(records)
+	}
+
+	stats.replayed -= stats.failed
+	log.Info("replay finished", "topic", ro.Topic, "replayed", stats.replayed, "filtered", stats.filtered,
+		"skipped", stats.skipped, "failed", stats.failed, "dryRun", ro.DryRun)
+	if stats.failed > 0 {
+		return fmt.Errorf("%d replayed records failed to be handled", stats.failed)
+	}
+
+	return nil
+}
+
+// replayRecord returns the record to replay for the dead letter record r, if it matches the
+// filters and tells where it comes from, with its headers rewritten
+func replayRecord(r *kgo.Record, ro ReplayOptions, stats *replayStats, log *slog.Logger) (*kgo.Record, bool) {
+	for _, filter := range ro.Filters {
+		if !filter.Match(r) {
+			stats.filtered++
+			return nil, false
+		}
+	}
+
+	replayed, ok := kafka.Replay(r, ro.TargetTopic)
+	if !ok {
+		stats.skipped++
+		log.Warn("dead letter record without origin topic - skipping it", "partition", r.Partition, "offset", r.Offset)
+		return nil, false
+	}
+
+	replayed.Headers = slices.DeleteFunc(replayed.Headers, func(h kgo.RecordHeader) bool {
+		return slices.Contains(ro.RemoveHeaders, h.Key) || slices.ContainsFunc(ro.SetHeaders, func(set kgo.RecordHeader) bool {
+			return set.Key == h.Key
+		})
+	})
+	replayed.Headers = append(replayed.Headers, ro.SetHeaders...)
+
+	if ro.DryRun {
+		stats.replayed++
+		log.Info("record would be replayed", "source", replaySource(replayed), "topic", replayed.Topic,
+			"key", string(replayed.Key), "handle", ro.Handle)
+	}
+
+	return replayed, true
+}
+
+// replaySource returns the dead letter record r was replayed from
+func replaySource(r *kgo.Record) string {
+	for _, h := range r.Headers {
+		if h.Key == kafka.ReplaySourceHeader {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,147 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/dedup"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/handler"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/kafka"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/telemetry"
+)
+
+const (
+	// abortBackoff is how long the consumer waits before processing aborted records again.
+	// It doubles with every consecutive abort, up to maxAbortBackoff.
+	abortBackoff    = 100 * time.Millisecond
+	maxAbortBackoff = 30 * time.Second
+)
+
+// consumeTransactional consumes in the exactly-once mode: every batch of fetched records is
+// handled in a transaction, which produces the records emitted by the handler and commits the
+// offsets of the batch atomically. If a record fails, it's sent to the dead letter topic in the
+// transaction or, without a dead letter topic, the transaction is aborted and the batch is
+// fetched and handled again after a backoff. The records of committed transactions are marked
+// as processed by dd, if not nil.
+func consumeTransactional(ctx context.Context, cp config.ConfigProvider, opts Options, dd *dedup.Deduplicator, log *slog.Logger, tel *telemetry.Telemetry) error {
+	if opts.direct(cp) {
+		return errors.New("the transactional mode requires a group and can't consume directly assigned partitions")
+	}
+
+	sess, err := kafka.NewTransactSession(ctx, cp)
+	if err != nil {
+		return errors.Join(errors.New("error creating kafka transactional session"), err)
+	}
+	defer sess.Close()
+
+	err = startClient(ctx, sess.Client(), cp, opts, log, tel)
+	if err != nil {
+		return err
+	}
+	log.Info("consuming transactionally", "transactionalID", kafka.TransactionalID(cp))
+
+	bh := batchHandler(opts)
+	aborts := 0
+	for {
+		fetches := sess.PollFetches(ctx)
+
+		if err := ctx.Err(); err != nil {
+			log.Info("consumer stopped - context cancelled")
+			break
+		}
+
+		if errs := fetches.Errors(); len(errs) > 0 {
+			for _, fErr := range errs {
+				log.Error("fetch error", "topic", fErr.Topic, "partition", fErr.Partition, "error", fErr.Err)
+			}
+		}
+
+		b := newBatches()
+		b.add(fetches, cp.GetHandler().BatchSize)
+		if b.empty() {
+			continue
+		}
+
+		committed, handleErr, err := handleInTransaction(ctx, cp, sess, kafka.NewTransactEmitter(sess), b, bh, log, tel)
+		if err != nil {
+			// errors ending a transaction aren't retryable
+			return err
+		}
+		if committed {
+			markProcessed(ctx, dd, log)
+			aborts = 0
+			continue
+		}
+		if dd != nil {
+			dd.Discard()
+		}
+
+		aborts++
+		backoff := min(abortBackoff<<min(aborts-1, 16), maxAbortBackoff)
+		if handleErr != nil {
+			log.Error("transaction aborted - records will be handled again",
+				"attempt", aborts, "backoff", backoff, "error", handleErr.Error())
+		} else {
+			// the group rebalanced during the transaction
+			log.Warn("transaction aborted after a rebalance - records will be handled again", "attempt", aborts)
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+	}
+
+	return nil
+}
+
+// transaction begins and ends the transactions of a kgo.GroupTransactSession
+type transaction interface {
+	Begin() error
+	End(ctx context.Context, commit kgo.TransactionEndTry) (bool, error)
+}
+
+// transactEmitter produces the records emitted in a transaction (see kafka.TransactEmitter)
+type transactEmitter interface {
+	handler.Emitter
+	Flush(ctx context.Context) error
+}
+
+// handleInTransaction handles the batches in a transaction, which is committed if every record
+// was handled, or sent to the dead letter topic, and every record emitted with emitter produced,
+// and aborted otherwise. handleErr is the reason the transaction was aborted, if any.
+func handleInTransaction(ctx context.Context, cp config.ConfigProvider, txn transaction, emitter transactEmitter, b *batches,
+	bh handler.BatchHandler, log *slog.Logger, tel *telemetry.Telemetry,
+) (committed bool, handleErr, err error) {
+	err = txn.Begin()
+	if err != nil {
+		return false, nil, errors.Join(errors.New("error beginning transaction"), err)
+	}
+
+	handlerCtx := handler.WithEmitter(ctx, emitter)
+
+	failures := b.handle(handlerCtx, bh, cp.GetHandler().BatchSize)
+	if len(failures) > 0 {
+		if cp.GetMessageQueueOptions().DLQTopic == "" {
+			handleErr = &handler.BatchError{Failures: failures}
+		} else {
+			// the failed records are sent to the dead letter topic in the transaction
+			handleErr = handleFailures(handlerCtx, cp, emitter, failures, log, tel)
+		}
+	}
+	if handleErr == nil {
+		handleErr = emitter.Flush(ctx)
+	}
+
+	committed, err = txn.End(ctx, kgo.TransactionEndTry(handleErr == nil))
+	if err != nil {
+		return false, handleErr, errors.Join(errors.New("error ending transaction"), err)
+	}
+
+	return committed, handleErr, nil
+}
@@ -0,0 +1,128 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/handler"
+)
+
+// testTransaction works like a kgo.GroupTransactSession: the records emitted in a transaction
+// are produced, and the offsets of the polled records committed, only if it's committed
+type testTransaction struct {
+	polled   []*kgo.Record
+	flushErr error
+
+	begun     bool
+	pending   []*kgo.Record
+	produced  []*kgo.Record
+	committed map[topicPartition]int64
+}
+
+func (tx *testTransaction) Begin() error {
+	if tx.begun {
+		return errors.New("transaction already begun")
+	}
+	tx.begun = true
+	return nil
+}
+
+func (tx *testTransaction) End(_ context.Context, commit kgo.TransactionEndTry) (bool, error) {
+	if !tx.begun {
+		return false, errors.New("no transaction begun")
+	}
+	tx.begun = false
+
+	if commit == kgo.TryAbort {
+		tx.pending = nil
+		return false, nil
+	}
+
+	tx.produced = append(tx.produced, tx.pending...)
+	tx.pending = nil
+	for _, r := range tx.polled {
+		tx.committed[topicPartition{topic: r.Topic, partition: r.Partition}] = r.Offset + 1
+	}
+	return true, nil
+}
+
+func (tx *testTransaction) Emit(_ context.Context, r *kgo.Record) error {
+	if !tx.begun {
+		return errors.New("record emitted outside of a transaction")
+	}
+	tx.pending = append(tx.pending, r)
+	return nil
+}
+
+func (tx *testTransaction) Flush(context.Context) error {
+	return tx.flushErr
+}
+
+func TestHandleInTransaction(t *testing.T) {
+	tests := []struct {
+		name          string
+		dlqTopic      string
+		fail          bool
+		flushErr      error
+		wantCommitted bool
+		wantProduced  []string
+	}{
+		{name: "handled", wantCommitted: true, wantProduced: []string{"out", "out"}},
+		{name: "failed without dead letter topic", fail: true},
+		{name: "failed with dead letter topic", dlqTopic: "orders-dlq", fail: true, wantCommitted: true, wantProduced: []string{"out", "out", "orders-dlq"}},
+		{name: "emitted records not produced", flushErr: errors.New("broker unavailable")},
+	}
+
+	tel := newTestTelemetry(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := []*kgo.Record{record("orders", 0, 0, time.Time{}), record("orders", 0, 1, time.Time{})}
+			tx := &testTransaction{polled: records, flushErr: tt.flushErr, committed: map[topicPartition]int64{}}
+			cp := testConfig{
+				options: config.KafkaOptions{DLQTopic: tt.dlqTopic},
+				handler: config.HandlerConfig{BatchSize: 10},
+			}
+
+			// every record emits a record, and the last one fails if asked to
+			bh := handler.PerRecord(handler.Func(func(ctx context.Context, r *kgo.Record) error {
+				if err := handler.Emit(ctx, &kgo.Record{Topic: "out", Value: r.Value}); err != nil {
+					return err
+				}
+				if tt.fail && r.Offset == 1 {
+					return errors.New("invalid record")
+				}
+				return nil
+			}))
+
+			committed, handleErr, err := handleInTransaction(context.Background(), cp, tx, tx, polled(10, records...),
+				bh, slog.New(slog.DiscardHandler), tel)
+			if err != nil {
+				t.Fatalf("unexpected error ending the transaction: %v", err)
+			}
+			if committed != tt.wantCommitted || (handleErr == nil) != tt.wantCommitted {
+				t.Fatalf("expected committed = %v but got %v with handle error %v", tt.wantCommitted, committed, handleErr)
+			}
+
+			var produced []string
+			for _, r := range tx.produced {
+				produced = append(produced, r.Topic)
+			}
+			if !slices.Equal(produced, tt.wantProduced) {
+				t.Fatalf("expected the records produced to %v but got %v", tt.wantProduced, produced)
+			}
+
+			// aborted transactions commit no offsets
+			offset, ok := tx.committed[topicPartition{topic: "orders", partition: 0}]
+			if ok != tt.wantCommitted || (ok && offset != 2) {
+				t.Fatalf("expected offsets committed = %v but got %v", tt.wantCommitted, tx.committed)
+			}
+		})
+	}
+}
@@ -1,70 +1,155 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"reflect"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
-	"github.com/rodney-b/swish-test-consumer/pkg/utilities/env"
+	"github.com/rodney-b/swish-test-consumer/pkg/certs"
 )
 
 type ConfigProvider interface {
 	IsDevelopment() bool
 	GetAppName() string
+	GetCertExpiryCheckInterval() time.Duration
+	GetCertExpiryWarningThresholds() []time.Duration
 	GetConsumerCA() []byte
 	GetConsumerCert() []byte
 	GetConsumerCertKey() []byte
-	GetHealthcheckPort() string
+	GetConsumerCertKeyPassword() string
+	GetDedup() DedupConfig
+	GetHandler() HandlerConfig
+	GetHealthcheckPort() uint16
 	GetHealthcheckServicePrefix() string
+	GetLogLevel() string
 	GetMessageQueueClientCA() []byte
 	GetMessageQueueClientCert() []byte
 	GetMessageQueueClientCertKey() []byte
+	GetMessageQueueClientCertKeyPassword() string
+	GetMessageQueueClientP12() []byte
 	GetMessageQueueGroupID() string
+	GetMessageQueueOptions() KafkaOptions
+	GetMessageQueueSASL() SASLConfig
+	GetMessageQueueTLSEnabled() bool
+	GetMessageQueueTLSPolicy() TLSPolicy
 	GetMessageQueueTopics() []string
-	GetMessageQueueURL() string
+	GetMessageQueueURLs() []string
 	GetOTelHTTPReceiverURL() string
 	GetOtelStdoutExporterEnabled() bool
+	GetOTelTLSPolicy() TLSPolicy
+	GetRoutingRules() []string
 	GetStage() string
+	Subscribe(sub Subscriber) (unsubscribe func())
 }
 
-// appCofnig implements ConfigProvider. It "provides" all its values from environment variables.
-// each data type must have a case statement in utilities.env.Get()
-// note: all types that can be casted to from int, are already covered
+// appCofnig implements ConfigProvider. It "provides" all its values from the config sources
+// (see newSources), checked in order of precedence:
+//   - envname: value set with Override (e.g. by a command line flag), then environment variable
+//   - secretfile: file relative to the CONFIG_SECRETS_DIR directory (e.g. a mounted kubernetes secret)
+//   - filekey: dot separated key in the YAML/JSON file at CONFIG_FILE
+//
+// values are checked against their `validate:"..."` tags (see rules) and appConfig.validate()
+// once loaded, and the app won't start with an invalid config.
+//
+// fields tagged `secret:"true"` are masked when the config is printed (see Explain).
+//
+// fields tagged `reload:"true"` are updated in place when the config is reloaded (see Watcher)
+// so their getters must hold mu.
+//
+// fields not found in any source use their `default:"..."` tag value, or are left empty if tagged
+// `required:"false"`. Every other field is required.
+//
+// each data type must be handled by utilities.env.SetSep()
+// note: all the basic kinds, durations, urls, TextUnmarshalers, slices and maps are already covered
 type appConfig struct {
-	appName                   string `envname:"APP_NAME"`
-	consumerCA                string `envname:"CONSUMER_CA"`
-	consumerCert              string `envname:"CONSUMER_CRT"`
-	consumerCertKey           string `envname:"CONSUMER_KEY"`
-	healthcheckPort           string `envname:"HEALTHCHECK_PORT"`
-	healthcheckServicePrefix  string `envname:"HEALTHCHECK_SERVICE_PREFIX"`
-	messageQueueClientCA      string `envname:"MESSAGE_QUEUE_CA"`
-	messageQueueClientCert    string `envname:"MESSAGE_QUEUE_CRT"`
-	messageQueueClientCertKey string `envname:"MESSAGE_QUEUE_KEY"`
-	messageQueueGroupID       string `envname:"MESSAGE_QUEUE_GROUP_ID"`
-	messageQueueTopics        string `envname:"MESSAGE_QUEUE_TOPICS"`
-	messageQueueURL           string `envname:"MESSAGE_QUEUE_URL"`
-	otelHTTPReceiverURL       string `envname:"OTEL_HTTP_RECEIVER_URL"`
-	otelStdoutExporterEnabled string `envname:"OTEL_STDOUT_EXPORTER_ENABLED"`
-	stage                     string `envname:"STAGE"`
+	mu          sync.RWMutex
+	subMu       sync.Mutex
+	subscribers []subscription
+	nextSubID   uint64
+
+	appName                           string          `envname:"APP_NAME" filekey:"appName"`
+	certExpiryCheckInterval           time.Duration   `envname:"CERT_EXPIRY_CHECK_INTERVAL" filekey:"certExpiry.checkInterval" default:"1h"`
+	certExpiryWarningThresholds       []time.Duration `envname:"CERT_EXPIRY_WARNING_THRESHOLDS" filekey:"certExpiry.warningThresholds" default:"720h,168h,24h"`
+	consumerCA                        []byte          `envname:"CONSUMER_CA" secretfile:"consumer/ca.crt" filekey:"consumer.ca" required:"false" validate:"pem" reload:"true"`
+	consumerCert                      []byte          `envname:"CONSUMER_CRT" secretfile:"consumer/tls.crt" filekey:"consumer.crt" required:"false" validate:"pem" reload:"true"`
+	consumerCertKey                   []byte          `envname:"CONSUMER_KEY" secretfile:"consumer/tls.key" filekey:"consumer.key" required:"false" validate:"pem" secret:"true" reload:"true"`
+	consumerCertKeyPassword           string          `envname:"CONSUMER_KEY_PASSWORD" secretfile:"consumer/tls.password" filekey:"consumer.keyPassword" required:"false" secret:"true" reload:"true"`
+	dedup                             DedupConfig     `envprefix:"DEDUP_" filekey:"dedup"`
+	handler                           HandlerConfig   `envprefix:"HANDLER_" filekey:"handler"`
+	healthcheckPort                   uint16          `envname:"HEALTHCHECK_PORT" filekey:"healthcheck.port" default:"50051" validate:"notempty,port"`
+	healthcheckServicePrefix          string          `envname:"HEALTHCHECK_SERVICE_PREFIX" filekey:"healthcheck.servicePrefix" validate:"notempty"`
+	logLevel                          string          `envname:"LOG_LEVEL" filekey:"logLevel" required:"false" validate:"oneof=debug info warn error" reload:"true"`
+	messageQueueClientCA              []byte          `envname:"MESSAGE_QUEUE_CA" secretfile:"message-queue-ca/ca.crt" filekey:"messageQueue.ca" required:"false" validate:"pem" reload:"true"`
+	messageQueueClientCert            []byte          `envname:"MESSAGE_QUEUE_CRT" secretfile:"message-queue/user.crt" filekey:"messageQueue.crt" required:"false" validate:"pem" reload:"true"`
+	messageQueueClientCertKey         []byte          `envname:"MESSAGE_QUEUE_KEY" secretfile:"message-queue/user.key" filekey:"messageQueue.key" required:"false" validate:"pem" secret:"true" reload:"true"`
+	messageQueueClientCertKeyPassword string          `envname:"MESSAGE_QUEUE_KEY_PASSWORD" secretfile:"message-queue/user.password" filekey:"messageQueue.keyPassword" required:"false" secret:"true" reload:"true"`
+	messageQueueClientP12             []byte          `envname:"MESSAGE_QUEUE_P12" secretfile:"message-queue/user.p12" filekey:"messageQueue.p12" required:"false" secret:"true" reload:"true"`
+	messageQueueGroupID               string          `envname:"MESSAGE_QUEUE_GROUP_ID" filekey:"messageQueue.groupID" validate:"notempty"`
+	messageQueueOptions               KafkaOptions    `envprefix:"MESSAGE_QUEUE_" filekey:"messageQueue"`
+	messageQueueSASL                  SASLConfig      `envprefix:"MESSAGE_QUEUE_SASL_" filekey:"messageQueue.sasl" secretfile:"message-queue-sasl"`
+	messageQueueTLSEnabled            bool            `envname:"MESSAGE_QUEUE_TLS_ENABLED" filekey:"messageQueue.tlsEnabled" default:"true"`
+	messageQueueTLSPolicy             TLSPolicy       `envprefix:"MESSAGE_QUEUE_TLS_" filekey:"messageQueue.tls"`
+	messageQueueTopics                []string        `envname:"MESSAGE_QUEUE_TOPICS" filekey:"messageQueue.topics" validate:"notempty" reload:"true" sep:"\n"`
+	messageQueueURLs                  []string        `envname:"MESSAGE_QUEUE_URL" filekey:"messageQueue.url" required:"false" validate:"hostport"`
+	otelHTTPReceiverURL               string          `envname:"OTEL_HTTP_RECEIVER_URL" filekey:"otel.httpReceiverURL" validate:"hostport"`
+	otelStdoutExporterEnabled         bool            `envname:"OTEL_STDOUT_EXPORTER_ENABLED" filekey:"otel.stdoutExporterEnabled" default:"false"`
+	otelTLSPolicy                     TLSPolicy       `envprefix:"OTEL_TLS_" filekey:"otel.tls"`
+	routingRules                      []string        `envname:"ROUTING_RULES" filekey:"routing.rules" required:"false" sep:"\n"`
+	stage                             string          `envname:"STAGE" filekey:"stage"`
 }
 
 func (ac *appConfig) GetAppName() string {
 	return ac.appName
 }
 
+func (ac *appConfig) GetCertExpiryCheckInterval() time.Duration {
+	return ac.certExpiryCheckInterval
+}
+
+func (ac *appConfig) GetCertExpiryWarningThresholds() []time.Duration {
+	return ac.certExpiryWarningThresholds
+}
+
 func (ac *appConfig) GetConsumerCA() []byte {
-	return []byte(ac.consumerCA)
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+
+	return ac.consumerCA
 }
 
 func (ac *appConfig) GetConsumerCert() []byte {
-	return []byte(ac.consumerCert)
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+
+	return ac.consumerCert
 }
 
 func (ac *appConfig) GetConsumerCertKey() []byte {
-	return []byte(ac.consumerCertKey)
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+
+	return ac.consumerCertKey
+}
+
+func (ac *appConfig) GetConsumerCertKeyPassword() string {
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+	return ac.consumerCertKeyPassword
 }
 
-func (ac *appConfig) GetHealthcheckPort() string {
+func (ac *appConfig) GetDedup() DedupConfig {
+	return ac.dedup
+}
+
+func (ac *appConfig) GetHandler() HandlerConfig {
+	return ac.handler
+}
+
+func (ac *appConfig) GetHealthcheckPort() uint16 {
 	return ac.healthcheckPort
 }
 
@@ -72,32 +157,77 @@ func (ac *appConfig) GetHealthcheckServicePrefix() string {
 	return ac.healthcheckServicePrefix
 }
 
+func (ac *appConfig) GetLogLevel() string {
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+
+	return ac.logLevel
+}
+
 func (ac *appConfig) GetMessageQueueClientCA() []byte {
-	return []byte(ac.messageQueueClientCA)
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+
+	return ac.messageQueueClientCA
 }
 
 func (ac *appConfig) GetMessageQueueClientCert() []byte {
-	return []byte(ac.messageQueueClientCert)
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+
+	return ac.messageQueueClientCert
 }
 
 func (ac *appConfig) GetMessageQueueClientCertKey() []byte {
-	return []byte(ac.messageQueueClientCertKey)
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+
+	return ac.messageQueueClientCertKey
+}
+
+func (ac *appConfig) GetMessageQueueClientCertKeyPassword() string {
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+	return ac.messageQueueClientCertKeyPassword
+}
+
+func (ac *appConfig) GetMessageQueueClientP12() []byte {
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+	return ac.messageQueueClientP12
 }
 
 func (ac *appConfig) GetMessageQueueGroupID() string {
 	return ac.messageQueueGroupID
 }
 
+func (ac *appConfig) GetMessageQueueOptions() KafkaOptions {
+	return ac.messageQueueOptions
+}
+
+func (ac *appConfig) GetMessageQueueSASL() SASLConfig {
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+	return ac.messageQueueSASL
+}
+
+func (ac *appConfig) GetMessageQueueTLSEnabled() bool {
+	return ac.messageQueueTLSEnabled
+}
+
+func (ac *appConfig) GetMessageQueueTLSPolicy() TLSPolicy {
+	return ac.messageQueueTLSPolicy
+}
+
 func (ac *appConfig) GetMessageQueueTopics() []string {
-	funcOnce := sync.OnceValue(func() []string {
-		return strings.Split(ac.messageQueueTopics, ",")
-	})
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
 
-	return funcOnce()
+	return ac.messageQueueTopics
 }
 
-func (ac *appConfig) GetMessageQueueURL() string {
-	return ac.messageQueueURL
+func (ac *appConfig) GetMessageQueueURLs() []string {
+	return ac.messageQueueURLs
 }
 
 func (ac *appConfig) GetOTelHTTPReceiverURL() string {
@@ -105,43 +235,147 @@ func (ac *appConfig) GetOTelHTTPReceiverURL() string {
 }
 
 func (ac *appConfig) GetOtelStdoutExporterEnabled() bool {
-	funcOnce := sync.OnceValue(func() bool {
-		if ac.otelStdoutExporterEnabled == "true" {
-			return true
-		}
+	return ac.otelStdoutExporterEnabled
+}
 
-		return false
-	})
+func (ac *appConfig) GetOTelTLSPolicy() TLSPolicy {
+	return ac.otelTLSPolicy
+}
 
-	return funcOnce()
+func (ac *appConfig) GetRoutingRules() []string {
+	return ac.routingRules
 }
 
 func (ac *appConfig) GetStage() string {
 	return ac.stage
 }
 
+// subscription is a subscriber registered with Subscribe
+type subscription struct {
+	id  uint64
+	sub Subscriber
+}
+
+// Subscribe registers sub to be called after each reload that changes the config (see Watcher),
+// until unsubscribe is called
+func (ac *appConfig) Subscribe(sub Subscriber) (unsubscribe func()) {
+	ac.subMu.Lock()
+	defer ac.subMu.Unlock()
+
+	ac.nextSubID++
+	id := ac.nextSubID
+	ac.subscribers = append(ac.subscribers, subscription{id: id, sub: sub})
+
+	return func() {
+		ac.subMu.Lock()
+		defer ac.subMu.Unlock()
+
+		ac.subscribers = slices.DeleteFunc(ac.subscribers, func(s subscription) bool {
+			return s.id == id
+		})
+	}
+}
+
+func (ac *appConfig) notify(change Change) {
+	ac.subMu.Lock()
+	subscribers := slices.Clone(ac.subscribers)
+	ac.subMu.Unlock()
+
+	for _, s := range subscribers {
+		s.sub(ac, change)
+	}
+}
+
 // helper funcs
 func (ac *appConfig) IsDevelopment() bool {
 	return ac.GetStage() != Production && ac.GetStage() != Staging
 }
 
+// validate runs the checks that can't be expressed with validate tags
+func (ac *appConfig) validate() []error {
+	var errs []error
+
+	if !slices.Contains(Stages, ac.stage) {
+		errs = append(errs, fmt.Errorf("invalid config value for stage: %q must be one of %v", ac.stage, Stages))
+	}
+
+	if ac.certExpiryCheckInterval <= 0 {
+		errs = append(errs, fmt.Errorf("invalid config value for certExpiryCheckInterval: %s must be positive", ac.certExpiryCheckInterval))
+	}
+
+	if ac.messageQueueTLSEnabled {
+		errs = append(errs, validateTLS("message queue", ac.messageQueueTLSPolicy, ac.IsDevelopment(),
+			ac.messageQueueClientMaterial())...)
+	}
+	if len(ac.messageQueueURLs) == 0 && len(ac.messageQueueOptions.SeedSRVRecords) == 0 {
+		errs = append(errs, errors.New("invalid message queue config: at least one seed broker URL or SRV record is required"))
+	}
+
+	errs = append(errs, validateSASL("message queue", ac.messageQueueSASL)...)
+	errs = append(errs, validateKafkaOptions("message queue", ac.messageQueueOptions)...)
+	errs = append(errs, validateDedup("dedup", ac.dedup)...)
+
+	if ac.handler.BatchTimeout >= ac.messageQueueOptions.RebalanceTimeout {
+		errs = append(errs, fmt.Errorf("invalid handler config: batch timeout %s must be shorter than the rebalance timeout %s",
+			ac.handler.BatchTimeout, ac.messageQueueOptions.RebalanceTimeout))
+	}
+
+	if ac.messageQueueOptions.TopicsRegex {
+		if err := rules["regexp"](reflect.ValueOf(ac.messageQueueTopics), ""); err != nil {
+			errs = append(errs, fmt.Errorf("invalid config value for messageQueueTopics: %w", err))
+		}
+	} else if slices.ContainsFunc(ac.messageQueueTopics, func(topic string) bool { return strings.Contains(topic, ",") }) {
+		// topic names can't have commas, the topics are most likely a comma separated list
+		errs = append(errs, fmt.Errorf("invalid config value for messageQueueTopics: topics %q are separated by newlines, not commas",
+			ac.messageQueueTopics))
+	}
+
+	// the consumer certificate is only used by the OTLP exporter
+	if !ac.otelStdoutExporterEnabled {
+		errs = append(errs, validateTLS("consumer", ac.otelTLSPolicy, ac.IsDevelopment(),
+			ac.consumerMaterial())...)
+	}
+
+	return errs
+}
+
+// messageQueueClientMaterial returns the TLS material of the message queue client
+func (ac *appConfig) messageQueueClientMaterial() certs.Material {
+	return certs.Material{
+		CACertPEM:     ac.messageQueueClientCA,
+		ClientCertPEM: ac.messageQueueClientCert,
+		ClientKeyPEM:  ac.messageQueueClientCertKey,
+		PKCS12:        ac.messageQueueClientP12,
+		Password:      ac.messageQueueClientCertKeyPassword,
+	}
+}
+
+// consumerMaterial returns the TLS material of the OTLP exporter
+func (ac *appConfig) consumerMaterial() certs.Material {
+	return certs.Material{
+		CACertPEM:     ac.consumerCA,
+		ClientCertPEM: ac.consumerCert,
+		ClientKeyPEM:  ac.consumerCertKey,
+		Password:      ac.consumerCertKeyPassword,
+	}
+}
+
 // These are for config values the app shouldn't start without.
 var initAppConfig = sync.OnceValues(func() (*appConfig, error) {
+	sources, err := newSources()
+	if err != nil {
+		return nil, err
+	}
+
 	ac := appConfig{}
-	appConfVal := reflect.ValueOf(&ac).Elem()
-	appConfType := reflect.TypeOf(ac)
-
-	for i := range appConfVal.NumField() {
-		fieldInfo := appConfType.Field(i)
-		fieldTag := fieldInfo.Tag
-		fieldValue := appConfVal.Field(i)
-		fieldPtr := fieldValue.Addr().UnsafePointer()
-		unsafeFieldValue := reflect.NewAt(fieldValue.Type(), fieldPtr).Elem()
-
-		err := env.Get(fieldTag.Get("envname"), unsafeFieldValue)
-		if err != nil {
-			return nil, err
-		}
+	err = load(&ac, sources)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validate(&ac)
+	if err != nil {
+		return nil, err
 	}
 
 	return &ac, nil
@@ -6,3 +6,12 @@ const (
 	Local      = "local"
 	Test       = "test"
 )
+
+// Stages lists every valid value for the STAGE config
+var Stages = []string{Production, Staging, Local, Test}
+
+// env vars used to locate the config sources other than environment variables
+const (
+	ConfigFileEnvName = "CONFIG_FILE"
+	SecretsDirEnvName = "CONFIG_SECRETS_DIR"
+)
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Deduplication ID extractors
+const (
+	DedupKey    = "key"
+	DedupHeader = "header"
+	DedupJSON   = "json"
+)
+
+// Deduplication stores
+const (
+	DedupMemory = "memory"
+	DedupDisk   = "disk"
+)
+
+// DedupConfig configures the deduplication of the consumed records. Deduplication is disabled
+// when Extractor is empty. Records are identified by their key, the Field header, or the Field
+// dot separated path of their JSON value, and the IDs of the records handled are kept for TTL in
+// the Store: an in-memory LRU of up to Size IDs per consumer, or a file at Path, which survives
+// restarts when Path is on a persistent volume.
+type DedupConfig struct {
+	Extractor string        `envname:"EXTRACTOR" filekey:"extractor" required:"false" validate:"oneof=key header json"`
+	Field     string        `envname:"FIELD" filekey:"field" required:"false"`
+	Store     string        `envname:"STORE" filekey:"store" default:"memory" validate:"oneof=memory disk"`
+	Size      int           `envname:"SIZE" filekey:"size" default:"100000" validate:"notempty,positive"`
+	TTL       time.Duration `envname:"TTL" filekey:"ttl" default:"24h" validate:"notempty,positive"`
+	Path      string        `envname:"PATH" filekey:"path" required:"false"`
+}
+
+// validateDedup checks that the settings needed by the extractor and store are set
+func validateDedup(name string, dedup DedupConfig) []error {
+	var errs []error
+
+	if dedup.Extractor == "" {
+		return nil
+	}
+
+	if (dedup.Extractor == DedupHeader || dedup.Extractor == DedupJSON) && dedup.Field == "" {
+		errs = append(errs, fmt.Errorf("invalid %s config: the %s extractor requires a field", name, dedup.Extractor))
+	}
+	if dedup.Store == DedupDisk && dedup.Path == "" {
+		errs = append(errs, fmt.Errorf("invalid %s config: the %s store requires a path", name, dedup.Store))
+	}
+
+	return errs
+}
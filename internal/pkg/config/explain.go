@@ -0,0 +1,120 @@
+package config
+
+import (
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// maskedValue replaces the value of fields tagged `secret:"true"`
+const maskedValue = "********"
+
+// Entry describes the effective value of a config field
+type Entry struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// Source is the config source the value came from (flag, env, secret or file),
+	// "default" if it's the field's default value, or empty if it's not set
+	Source string `json:"source"`
+}
+
+// Explain loads the config from its sources the same way InitAppConfig does and describes every
+// field's value and where it came from, masking secrets. Unlike InitAppConfig, the entries are
+// returned even if the config is invalid, along with an error listing every problem.
+func Explain() ([]Entry, error) {
+	sources, err := newSources()
+	if err != nil {
+		return nil, err
+	}
+
+	ac := appConfig{}
+	fieldOrigins := origins{}
+	errs := loadStruct(reflect.ValueOf(&ac).Elem(), fieldPrefix{}, sources, fieldOrigins)
+
+	// validating a partially loaded config would mostly repeat the load errors
+	if len(errs) == 0 {
+		errs = append(errs, validate(&ac))
+	}
+
+	entries := explainStruct(reflect.ValueOf(&ac).Elem(), fieldPrefix{}, fieldOrigins)
+	return entries, errors.Join(errs...)
+}
+
+func explainStruct(structVal reflect.Value, prefix fieldPrefix, fieldOrigins origins) []Entry {
+	structType := structVal.Type()
+	var entries []Entry
+
+	for i := range structVal.NumField() {
+		fieldInfo := prefix.apply(structType.Field(i))
+		if !isConfigField(fieldInfo) {
+			continue
+		}
+
+		fieldValue := structVal.Field(i)
+		unsafeFieldValue := reflect.NewAt(fieldValue.Type(), fieldValue.Addr().UnsafePointer()).Elem()
+
+		if isNestedStruct(fieldInfo) {
+			entries = append(entries, explainStruct(unsafeFieldValue, nestedPrefix(fieldInfo), fieldOrigins)...)
+			continue
+		}
+
+		name := fieldName(fieldInfo)
+		entries = append(entries, Entry{
+			Name:   name,
+			Value:  describeValue(fieldInfo, unsafeFieldValue),
+			Source: fieldOrigins[name],
+		})
+	}
+
+	return entries
+}
+
+// describeValue formats val for display. PEM data is summarized rather than printed in full.
+func describeValue(field reflect.StructField, val reflect.Value) string {
+	switch val.Kind() {
+	case reflect.Pointer:
+		if val.IsNil() {
+			return ""
+		}
+	case reflect.String, reflect.Slice, reflect.Map:
+		if val.Len() == 0 {
+			return ""
+		}
+	}
+
+	if secret, _ := strconv.ParseBool(field.Tag.Get("secret")); secret {
+		return maskedValue
+	}
+
+	if val.Type() == reflect.TypeFor[[]byte]() {
+		return describeBytes(val.Bytes())
+	}
+
+	if val.Kind() == reflect.Slice {
+		return strings.Join(stringValues(val), separator(field))
+	}
+
+	return fmt.Sprint(val.Interface())
+}
+
+// describeBytes lists the PEM blocks in data e.g. "PEM: CERTIFICATE, CERTIFICATE"
+func describeBytes(data []byte) string {
+	var blockTypes []string
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		blockTypes = append(blockTypes, block.Type)
+	}
+
+	if len(blockTypes) == 0 {
+		return fmt.Sprintf("<%d bytes>", len(data))
+	}
+
+	return "PEM: " + strings.Join(blockTypes, ", ")
+}
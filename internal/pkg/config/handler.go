@@ -0,0 +1,15 @@
+package config
+
+import (
+	"time"
+)
+
+// HandlerConfig configures how the consumed records are passed to the batch handler, if any
+// (see handler.BatchHandler). Batches hold up to BatchSize records of a partition. The records of
+// a partition are handled once it has BatchSize records or BatchTimeout elapsed since its first
+// record was polled, each partition on its own clock. The consumer keeps polling meanwhile, so
+// BatchTimeout must be shorter than the rebalance timeout.
+type HandlerConfig struct {
+	BatchSize    int           `envname:"BATCH_SIZE" filekey:"batchSize" default:"500" validate:"notempty,positive"`
+	BatchTimeout time.Duration `envname:"BATCH_TIMEOUT" filekey:"batchTimeout" default:"200ms" validate:"notempty,positive"`
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Isolation levels of the kafka consumer
+const (
+	ReadUncommitted = "read_uncommitted"
+	ReadCommitted   = "read_committed"
+)
+
+// Group balancers of the kafka consumer
+const (
+	RangeBalancer             = "range"
+	RoundRobinBalancer        = "roundrobin"
+	StickyBalancer            = "sticky"
+	CooperativeStickyBalancer = "cooperative-sticky"
+)
+
+// Partitioners of the records produced by the handlers
+const (
+	UniformBytesPartitioner = "uniform-bytes"
+	StickyKeyPartitioner    = "sticky-key"
+	RoundRobinPartitioner   = "round-robin"
+	ManualPartitioner       = "manual"
+)
+
+// KafkaOptions tunes the kafka consumer. The defaults are the franz-go defaults, apart from the
+// client ID which defaults to the app name. See the kgo options of the same names for details.
+//
+// InstanceID enables static group membership: a restarted consumer rejoining with the same
+// instance ID within the session timeout gets its partitions back without a rebalance.
+// It must be unique within the group and stable across restarts, e.g. a StatefulSet pod name.
+// Static members don't leave the group when they stop, so their partitions are only reassigned
+// after the session timeout. The cooperative-sticky balancer (the default) rebalances
+// incrementally, so members keep consuming the partitions they keep during a rebalance.
+//
+// With TopicsRegex, the topics are regular expressions matched against every topic of the cluster
+// and topics matching ExcludeTopics are skipped. New topics are picked up when the metadata is
+// refreshed, at least every MetadataMaxAge.
+//
+// StartOffset is where the group starts consuming the partitions it has no committed offset for,
+// and ResetOffset where it restarts after an out of range offset (the start offset by default).
+// PartitionOffsets overrides the start offset of "<topic>/<partition>" keys with exact offsets,
+// which are committed for the group at startup unless it already has a committed offset.
+//
+// Assignments switches the consumer to direct partition assignment: the "<topic>/<partition>"
+// keys are consumed from their offsets without joining the group or committing offsets, and
+// the topics are ignored. It's meant for debugging, replays and sidecar readers.
+//
+// Transactional switches the consumer to the exactly-once mode: the records emitted by the
+// handlers of a batch of fetched records are produced in a transaction committing the offsets
+// of the batch, and records are consumed with the read_committed isolation level. Failed
+// batches are aborted and processed again. The transactional ID is the prefix (the group ID by
+// default) followed by the instance ID, or the hostname, so it must be unique and stable.
+//
+// Records emitted by the handlers without a topic go to OutputTopic, in every mode. They're
+// spread over the partitions by the Partitioner: keyed records always go to the partition
+// of their key hash with the uniform-bytes (the default) and sticky-key partitioners, while
+// the manual partitioner uses the partition set on the records. Records that failed to be
+// handled are sent to DLQTopic, if set, with headers describing the failure.
+//
+// RetryDelays enables non-blocking retries: a record that failed is sent to the retry topic of
+// its topic for the first delay, "<topic>.retry.<delay>" e.g. "orders.retry.1m", then to the
+// one for the next delay if it fails again, and to the dead letter topic once retried after
+// every delay. The consumer subscribes to the retry topics too, which must exist, and pauses a
+// retry partition until its next record is due. Regex topics must match the retry topics.
+// Retries aren't supported in the transactional mode, where failures abort the transaction.
+//
+// SeedSRVRecords and ResolveSeeds add seed brokers discovered through DNS to the configured ones:
+// the targets of the SRV records (e.g. the ones published for the ports of a headless service)
+// and, with ResolveSeeds, every address of the seed hostnames. Resolved addresses are IPs so the
+// broker certificates need IP SANs, or the TLS server name must be set.
+type KafkaOptions struct {
+	TopicsRegex            bool              `envname:"TOPICS_REGEX" filekey:"topicsRegex" default:"false"`
+	ExcludeTopics          []string          `envname:"EXCLUDE_TOPICS" filekey:"excludeTopics" required:"false" validate:"regexp" sep:"\n"`
+	MetadataMaxAge         time.Duration     `envname:"METADATA_MAX_AGE" filekey:"metadataMaxAge" default:"5m" validate:"notempty,positive"`
+	StartOffset            Offset            `envname:"START_OFFSET" filekey:"startOffset" default:"earliest"`
+	ResetOffset            Offset            `envname:"RESET_OFFSET" filekey:"resetOffset" required:"false"`
+	PartitionOffsets       map[string]int64  `envname:"PARTITION_OFFSETS" filekey:"partitionOffsets" required:"false"`
+	Assignments            map[string]Offset `envname:"ASSIGNMENTS" filekey:"assignments" required:"false"`
+	Transactional          bool              `envname:"TRANSACTIONAL" filekey:"transactional" default:"false"`
+	TransactionalIDPrefix  string            `envname:"TRANSACTIONAL_ID_PREFIX" filekey:"transactionalIDPrefix" required:"false"`
+	TransactionTimeout     time.Duration     `envname:"TRANSACTION_TIMEOUT" filekey:"transactionTimeout" default:"40s" validate:"notempty,positive"`
+	OutputTopic            string            `envname:"OUTPUT_TOPIC" filekey:"outputTopic" required:"false"`
+	DLQTopic               string            `envname:"DLQ_TOPIC" filekey:"dlqTopic" required:"false"`
+	RetryDelays            []time.Duration   `envname:"RETRY_DELAYS" filekey:"retryDelays" required:"false"`
+	Partitioner            string            `envname:"PARTITIONER" filekey:"partitioner" default:"uniform-bytes" validate:"oneof=uniform-bytes sticky-key round-robin manual"`
+	SeedSRVRecords         []string          `envname:"SEED_SRV_RECORDS" filekey:"seedSRVRecords" required:"false"`
+	ResolveSeeds           bool              `envname:"RESOLVE_SEEDS" filekey:"resolveSeeds" default:"false"`
+	ClientID               string            `envname:"CLIENT_ID" filekey:"clientID" required:"false"`
+	InstanceID             string            `envname:"INSTANCE_ID" filekey:"instanceID" required:"false"`
+	Rack                   string            `envname:"RACK" filekey:"rack" required:"false"`
+	FetchMaxBytes          int32             `envname:"FETCH_MAX_BYTES" filekey:"fetchMaxBytes" default:"52428800" validate:"notempty,positive"`
+	FetchMaxPartitionBytes int32             `envname:"FETCH_MAX_PARTITION_BYTES" filekey:"fetchMaxPartitionBytes" default:"1048576" validate:"notempty,positive"`
+	FetchMinBytes          int32             `envname:"FETCH_MIN_BYTES" filekey:"fetchMinBytes" default:"1" validate:"notempty,positive"`
+	FetchMaxWait           time.Duration     `envname:"FETCH_MAX_WAIT" filekey:"fetchMaxWait" default:"5s" validate:"notempty,positive"`
+	IsolationLevel         string            `envname:"ISOLATION_LEVEL" filekey:"isolationLevel" default:"read_uncommitted" validate:"oneof=read_uncommitted read_committed"`
+	Balancers              []string          `envname:"BALANCERS" filekey:"balancers" default:"cooperative-sticky" validate:"notempty,oneof=range roundrobin sticky cooperative-sticky"`
+	SessionTimeout         time.Duration     `envname:"SESSION_TIMEOUT" filekey:"sessionTimeout" default:"45s" validate:"notempty,positive"`
+	HeartbeatInterval      time.Duration     `envname:"HEARTBEAT_INTERVAL" filekey:"heartbeatInterval" default:"3s" validate:"notempty,positive"`
+	RebalanceTimeout       time.Duration     `envname:"REBALANCE_TIMEOUT" filekey:"rebalanceTimeout" default:"60s" validate:"notempty,positive"`
+}
+
+// validateKafkaOptions checks the options that depend on each other
+func validateKafkaOptions(name string, opts KafkaOptions) []error {
+	var errs []error
+
+	if opts.FetchMinBytes > opts.FetchMaxBytes {
+		errs = append(errs, fmt.Errorf("invalid %s options: fetch min bytes %d is greater than fetch max bytes %d",
+			name, opts.FetchMinBytes, opts.FetchMaxBytes))
+	}
+
+	if opts.HeartbeatInterval >= opts.SessionTimeout {
+		errs = append(errs, fmt.Errorf("invalid %s options: heartbeat interval %s must be shorter than the session timeout %s",
+			name, opts.HeartbeatInterval, opts.SessionTimeout))
+	}
+
+	if _, err := PartitionOffsets(opts.PartitionOffsets); err != nil {
+		errs = append(errs, fmt.Errorf("invalid %s options: partition offsets: %w", name, err))
+	}
+
+	if _, err := Assignments(opts.Assignments); err != nil {
+		errs = append(errs, fmt.Errorf("invalid %s options: assignments: %w", name, err))
+	}
+	if len(opts.Assignments) > 0 && opts.TopicsRegex {
+		errs = append(errs, fmt.Errorf("invalid %s options: assignments can't be combined with regex topics", name))
+	}
+
+	for i, delay := range opts.RetryDelays {
+		if delay <= 0 {
+			errs = append(errs, fmt.Errorf("invalid %s options: retry delay %s must be positive", name, delay))
+		}
+		if slices.Contains(opts.RetryDelays[:i], delay) {
+			errs = append(errs, fmt.Errorf("invalid %s options: retry delay %s is listed twice", name, delay))
+		}
+	}
+	if opts.Transactional && len(opts.RetryDelays) > 0 {
+		errs = append(errs, fmt.Errorf("invalid %s options: retry topics aren't supported in the transactional mode", name))
+	}
+
+	if opts.Transactional && opts.IsDirect() {
+		errs = append(errs, fmt.Errorf("invalid %s options: the transactional mode requires a group and can't be combined with assignments", name))
+	}
+
+	if len(opts.ExcludeTopics) > 0 && !opts.TopicsRegex {
+		errs = append(errs, fmt.Errorf("invalid %s options: excluded topics are only supported with regex topics", name))
+	}
+
+	return errs
+}
+
+// IsDirect reports whether the consumer uses direct partition assignment instead of a group
+func (opts KafkaOptions) IsDirect() bool {
+	return len(opts.Assignments) > 0
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/rodney-b/swish-test-consumer/pkg/utilities/env"
+)
+
+// load populates the fields of the struct pointed to by dst from sources.
+// Unexported fields are set using unsafe pointers since the config structs keep
+// their fields private and only expose getters.
+//
+// Fields without a value in any source fall back to their `default:"..."` tag. Fields
+// without a default are required unless tagged `required:"false"`, in which case they're
+// left at their zero value. Every missing or invalid value is reported in the returned error.
+//
+// Slice and map items are separated by commas unless the field has a `sep:"..."` tag.
+// Struct fields are loaded recursively, with their envprefix, filekey and secretfile tags
+// prefixing the names of their own fields (see fieldPrefix).
+func load(dst any, sources []source) error {
+	return errors.Join(loadStruct(reflect.ValueOf(dst).Elem(), fieldPrefix{}, sources, origins{})...)
+}
+
+// origins maps the name of each loaded field (see fieldName) to the name of the source
+// its value came from, or originDefault if it was set by its default tag
+type origins map[string]string
+
+const originDefault = "default"
+
+func loadStruct(structVal reflect.Value, prefix fieldPrefix, sources []source, fieldOrigins origins) []error {
+	structType := structVal.Type()
+	var errs []error
+
+	for i := range structVal.NumField() {
+		fieldInfo := prefix.apply(structType.Field(i))
+		if !isConfigField(fieldInfo) {
+			continue
+		}
+
+		fieldValue := structVal.Field(i)
+		fieldPtr := fieldValue.Addr().UnsafePointer()
+		unsafeFieldValue := reflect.NewAt(fieldValue.Type(), fieldPtr).Elem()
+
+		if isNestedStruct(fieldInfo) {
+			errs = append(errs, loadStruct(unsafeFieldValue, nestedPrefix(fieldInfo), sources, fieldOrigins)...)
+			continue
+		}
+
+		rawVal, origin, found, err := lookup(fieldInfo, sources)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !found {
+			rawVal, found = fieldInfo.Tag.Lookup("default")
+			origin = originDefault
+		}
+		if !found {
+			if isRequired(fieldInfo) {
+				errs = append(errs, fmt.Errorf("unable to find a config value for %s", describeField(fieldInfo)))
+			}
+			continue
+		}
+
+		err = env.SetSep(unsafeFieldValue, rawVal, separator(fieldInfo))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid config value for %s: %w", describeField(fieldInfo), err))
+			continue
+		}
+
+		fieldOrigins[fieldName(fieldInfo)] = origin
+	}
+
+	return errs
+}
+
+// fieldPrefix holds the names inherited from the parents of a nested config struct e.g.
+//
+//	kafka kafkaConfig `envprefix:"KAFKA_" filekey:"kafka" secretfile:"kafka"`
+//
+// makes the field `envname:"CLIENT_ID" filekey:"clientID"` of kafkaConfig
+// `envname:"KAFKA_CLIENT_ID" filekey:"kafka.clientID"`
+type fieldPrefix struct {
+	env    string
+	file   string
+	secret string
+}
+
+// nestedPrefix returns the prefix for the fields of the struct field.
+// field must already have its parent's prefix applied.
+func nestedPrefix(field reflect.StructField) fieldPrefix {
+	return fieldPrefix{
+		env:    field.Tag.Get("envprefix"),
+		file:   field.Tag.Get("filekey"),
+		secret: field.Tag.Get("secretfile"),
+	}
+}
+
+// apply returns field with the prefixed names prepended to its tag.
+// StructTag.Get returns the first match so the prefixed names take precedence.
+func (fp fieldPrefix) apply(field reflect.StructField) reflect.StructField {
+	if fp == (fieldPrefix{}) {
+		return field
+	}
+
+	var prefixed []string
+	if name := field.Tag.Get("envname"); name != "" {
+		prefixed = append(prefixed, fmt.Sprintf("envname:%q", fp.env+name))
+	}
+	if name, ok := field.Tag.Lookup("envprefix"); ok {
+		prefixed = append(prefixed, fmt.Sprintf("envprefix:%q", fp.env+name))
+	}
+	if name := field.Tag.Get("filekey"); name != "" && fp.file != "" {
+		prefixed = append(prefixed, fmt.Sprintf("filekey:%q", fp.file+"."+name))
+	}
+	if name := field.Tag.Get("secretfile"); name != "" && fp.secret != "" {
+		prefixed = append(prefixed, fmt.Sprintf("secretfile:%q", fp.secret+"/"+name))
+	}
+
+	field.Tag = reflect.StructTag(strings.Join(append(prefixed, string(field.Tag)), " "))
+	return field
+}
+
+// isConfigField reports whether field is loaded from the config sources, as opposed to
+// fields used internally by the config structs (e.g. locks)
+func isConfigField(field reflect.StructField) bool {
+	for _, tag := range []string{"envname", "envprefix", "secretfile", "filekey"} {
+		if _, ok := field.Tag.Lookup(tag); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isNestedStruct reports whether field is a struct whose fields should be loaded individually,
+// as opposed to a struct type decoded from a single value (e.g. one implementing encoding.TextUnmarshaler)
+func isNestedStruct(field reflect.StructField) bool {
+	if field.Type.Kind() != reflect.Struct {
+		return false
+	}
+
+	_, hasPrefix := field.Tag.Lookup("envprefix")
+	return hasPrefix && !reflect.PointerTo(field.Type).Implements(reflect.TypeFor[encoding.TextUnmarshaler]())
+}
+
+// separator returns the separator for the field's slice or map items
+func separator(field reflect.StructField) string {
+	if sep := field.Tag.Get("sep"); sep != "" {
+		return sep
+	}
+
+	return env.DefaultSeparator
+}
+
+// isRequired reports whether the field must be set, which is the case unless it's tagged `required:"false"`
+func isRequired(field reflect.StructField) bool {
+	required, err := strconv.ParseBool(field.Tag.Get("required"))
+	return err != nil || required
+}
+
+// lookup returns the value from the first source (in order of precedence) that holds one,
+// along with the source's name
+func lookup(field reflect.StructField, sources []source) (string, string, bool, error) {
+	for _, src := range sources {
+		val, found, err := src.Lookup(field)
+		if err != nil {
+			return "", "", false, err
+		}
+		if found {
+			return val, src.Name(), true, nil
+		}
+	}
+
+	return "", "", false, nil
+}
+
+// describeField lists the names a field can be set by, for error messages
+func describeField(field reflect.StructField) string {
+	var names []string
+	for _, tag := range []string{"envname", "secretfile", "filekey"} {
+		if name := field.Tag.Get(tag); name != "" {
+			names = append(names, fmt.Sprintf("%s %q", tag, name))
+		}
+	}
+
+	return fmt.Sprintf("%s (%s)", field.Name, strings.Join(names, ", "))
+}
@@ -0,0 +1,409 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testSourcesConfig struct {
+	appName  string `envname:"TEST_APP_NAME" filekey:"appName"`
+	caCert   string `envname:"TEST_CA" secretfile:"ca.crt" filekey:"tls.ca"`
+	groupID  string `envname:"TEST_GROUP_ID" secretfile:"group" filekey:"messageQueue.groupID"`
+	replicas int    `envname:"TEST_REPLICAS" filekey:"replicas"`
+}
+
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatalf("error writing test file %s: %v", name, err)
+	}
+
+	return path
+}
+
+func TestLoadSourcePrecedence(t *testing.T) {
+	dir := t.TempDir()
+	secretsDir := t.TempDir()
+
+	yamlPath := writeTestFile(t, dir, "config.yaml", `
+appName: from-file
+replicas: 3
+tls:
+  ca: file-ca
+messageQueue:
+  groupID: file-group
+`)
+	jsonPath := writeTestFile(t, dir, "config.json", `{"appName": "from-json", "replicas": 5, "messageQueue": {"groupID": "json-group"}}`)
+	writeTestFile(t, secretsDir, "ca.crt", "secret-ca\n")
+	writeTestFile(t, secretsDir, "group", "secret-group")
+
+	tests := []struct {
+		name      string
+		env       map[string]string
+		overrides map[string]string
+		file      string
+		expected  testSourcesConfig
+	}{
+		{
+			name: "yaml file and secrets",
+			file: yamlPath,
+			expected: testSourcesConfig{
+				appName:  "from-file",
+				caCert:   "secret-ca",
+				groupID:  "secret-group",
+				replicas: 3,
+			},
+		},
+		{
+			name: "json file and secrets",
+			file: jsonPath,
+			expected: testSourcesConfig{
+				appName:  "from-json",
+				caCert:   "secret-ca",
+				groupID:  "secret-group",
+				replicas: 5,
+			},
+		},
+		{
+			name: "env overrides secrets and file",
+			env: map[string]string{
+				"TEST_GROUP_ID": "env-group",
+				"TEST_REPLICAS": "7",
+			},
+			file: yamlPath,
+			expected: testSourcesConfig{
+				appName:  "from-file",
+				caCert:   "secret-ca",
+				groupID:  "env-group",
+				replicas: 7,
+			},
+		},
+		{
+			name: "overrides override env, secrets and file",
+			env: map[string]string{
+				"TEST_GROUP_ID": "env-group",
+				"TEST_REPLICAS": "7",
+			},
+			overrides: map[string]string{
+				"TEST_GROUP_ID": "flag-group",
+				"TEST_CA":       "flag-ca",
+			},
+			file: yamlPath,
+			expected: testSourcesConfig{
+				appName:  "from-file",
+				caCert:   "flag-ca",
+				groupID:  "flag-group",
+				replicas: 7,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(SecretsDirEnvName, secretsDir)
+			t.Setenv(ConfigFileEnvName, tt.file)
+			for name, val := range tt.env {
+				t.Setenv(name, val)
+			}
+			// set directly since Override only accepts the names of the app config
+			overrides = tt.overrides
+			t.Cleanup(func() { overrides = nil })
+
+			sources, err := newSources()
+			if err != nil {
+				t.Fatalf("error creating config sources: %v", err)
+			}
+
+			actual := testSourcesConfig{}
+			err = load(&actual, sources)
+			if err != nil {
+				t.Fatalf("error loading config: %v", err)
+			}
+
+			if actual != tt.expected {
+				t.Fatalf("unexpected config - expected %+v but got %+v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+type testNumbersConfig struct {
+	fetchMaxBytes int32   `envname:"TEST_FETCH_MAX_BYTES" filekey:"fetch.maxBytes"`
+	offset        int64   `envname:"TEST_OFFSET" filekey:"offset"`
+	ratio         float64 `envname:"TEST_RATIO" filekey:"ratio"`
+}
+
+func TestLoadFileNumbers(t *testing.T) {
+	dir := t.TempDir()
+	expected := testNumbersConfig{fetchMaxBytes: 52428800, offset: 1000000, ratio: 0.25}
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "config.json", content: `{"fetch": {"maxBytes": 52428800}, "offset": 1000000, "ratio": 0.25}`},
+		{name: "config.yaml", content: "fetch:\n  maxBytes: 52428800\noffset: 1000000\nratio: 0.25\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(ConfigFileEnvName, writeTestFile(t, dir, tt.name, tt.content))
+
+			sources, err := newSources()
+			if err != nil {
+				t.Fatalf("error creating config sources: %v", err)
+			}
+
+			actual := testNumbersConfig{}
+			err = load(&actual, sources)
+			if err != nil {
+				t.Fatalf("error loading config: %v", err)
+			}
+			if actual != expected {
+				t.Fatalf("unexpected config - expected %+v but got %+v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestOverride(t *testing.T) {
+	t.Cleanup(func() { overrides = nil })
+
+	tests := []struct {
+		name    string
+		values  map[string]string
+		wantErr bool
+	}{
+		{name: "top level value", values: map[string]string{"MESSAGE_QUEUE_TOPICS": "orders"}},
+		{name: "nested value", values: map[string]string{"DEDUP_STORE": "disk", "MESSAGE_QUEUE_DLQ_TOPIC": "orders-dlq"}},
+		{name: "unknown value", values: map[string]string{"MESSAGE_QUEUE_TOPIC": "orders"}, wantErr: true},
+		{name: "prefix", values: map[string]string{"DEDUP_": "disk"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Override(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %t but got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+type testOptionalConfig struct {
+	appName  string `envname:"TEST_APP_NAME"`
+	logLevel string `envname:"TEST_LOG_LEVEL" default:"info"`
+	replicas int    `envname:"TEST_REPLICAS" default:"1"`
+	rack     string `envname:"TEST_RACK" required:"false"`
+	port     uint16 `envname:"TEST_PORT"`
+	groupID  string `envname:"TEST_GROUP_ID"`
+}
+
+func TestLoadDefaultsAndOptional(t *testing.T) {
+	t.Setenv("TEST_APP_NAME", "optional-test")
+	t.Setenv("TEST_REPLICAS", "4")
+	t.Setenv("TEST_PORT", "8080")
+	t.Setenv("TEST_GROUP_ID", "group")
+
+	expected := testOptionalConfig{
+		appName:  "optional-test",
+		logLevel: "info",
+		replicas: 4,
+		port:     8080,
+		groupID:  "group",
+	}
+
+	actual := testOptionalConfig{}
+	err := load(&actual, []source{envSource{}})
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+
+	if actual != expected {
+		t.Fatalf("unexpected config - expected %+v but got %+v", expected, actual)
+	}
+}
+
+func TestLoadAggregatesErrors(t *testing.T) {
+	t.Setenv("TEST_PORT", "not-a-port")
+
+	err := load(&testOptionalConfig{}, []source{envSource{}})
+	if err == nil {
+		t.Fatal("expected an error for missing and invalid config values but got nil")
+	}
+
+	// TEST_APP_NAME & TEST_GROUP_ID are missing, TEST_PORT is invalid
+	var joinErr interface{ Unwrap() []error }
+	if !errors.As(err, &joinErr) || len(joinErr.Unwrap()) != 3 {
+		t.Fatalf("expected 3 aggregated errors but got: %v", err)
+	}
+}
+
+type testNestedTLS struct {
+	ca  []byte `envname:"CA" secretfile:"ca.crt" filekey:"ca"`
+	crt []byte `envname:"CRT" secretfile:"tls.crt" filekey:"crt"`
+}
+
+type testNestedKafka struct {
+	clientID string            `envname:"CLIENT_ID" filekey:"clientID"`
+	fetchMax int32             `envname:"FETCH_MAX_BYTES" filekey:"fetchMaxBytes" default:"1024"`
+	labels   map[string]string `envname:"LABELS" filekey:"labels" sep:";"`
+	tls      testNestedTLS     `envprefix:"TLS_" filekey:"tls" secretfile:"kafka"`
+}
+
+type testNestedConfig struct {
+	appName string          `envname:"TEST_APP_NAME" filekey:"appName"`
+	kafka   testNestedKafka `envprefix:"TEST_KAFKA_" filekey:"kafka"`
+}
+
+func TestLoadNestedStructs(t *testing.T) {
+	dir := t.TempDir()
+	secretsDir := t.TempDir()
+
+	err := os.Mkdir(filepath.Join(secretsDir, "kafka"), 0o700)
+	if err != nil {
+		t.Fatalf("error creating secrets dir: %v", err)
+	}
+	writeTestFile(t, filepath.Join(secretsDir, "kafka"), "tls.crt", "secret-crt")
+
+	yamlPath := writeTestFile(t, dir, "config.yaml", `
+appName: nested
+kafka:
+  clientID: file-client
+  labels:
+    team: data
+  tls:
+    ca: file-ca
+`)
+
+	t.Setenv(SecretsDirEnvName, secretsDir)
+	t.Setenv(ConfigFileEnvName, yamlPath)
+	t.Setenv("TEST_KAFKA_CLIENT_ID", "env-client")
+
+	sources, err := newSources()
+	if err != nil {
+		t.Fatalf("error creating config sources: %v", err)
+	}
+
+	actual := testNestedConfig{}
+	err = load(&actual, sources)
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+
+	errBadValue := "invalid value for %s - expected %v but got %v"
+	if actual.kafka.clientID != "env-client" {
+		t.Fatalf(errBadValue, "kafka.clientID", "env-client", actual.kafka.clientID)
+	}
+	if actual.kafka.fetchMax != 1024 {
+		t.Fatalf(errBadValue, "kafka.fetchMax", 1024, actual.kafka.fetchMax)
+	}
+	if actual.kafka.labels["team"] != "data" {
+		t.Fatalf(errBadValue, "kafka.labels", "team=data", actual.kafka.labels)
+	}
+	if string(actual.kafka.tls.ca) != "file-ca" {
+		t.Fatalf(errBadValue, "kafka.tls.ca", "file-ca", string(actual.kafka.tls.ca))
+	}
+	if string(actual.kafka.tls.crt) != "secret-crt" {
+		t.Fatalf(errBadValue, "kafka.tls.crt", "secret-crt", string(actual.kafka.tls.crt))
+	}
+}
+
+func TestLoadOffsets(t *testing.T) {
+	type testOffsetConfig struct {
+		offset Offset           `envname:"TEST_OFFSET"`
+		reset  Offset           `envname:"TEST_RESET_OFFSET" required:"false"`
+		pinned map[string]int64 `envname:"TEST_PARTITION_OFFSETS" required:"false"`
+	}
+
+	timestamp := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		offset string
+		want   Offset
+		err    bool
+	}{
+		{name: "earliest", offset: "earliest", want: Offset{Position: OffsetEarliest}},
+		{name: "latest", offset: " latest ", want: Offset{Position: OffsetLatest}},
+		{name: "none", offset: "none", want: Offset{Position: OffsetNone}},
+		{name: "exact", offset: "1500", want: Offset{Position: OffsetExact, Exact: 1500}},
+		{name: "timestamp", offset: "2026-10-01T14:00:00+02:00", want: Offset{Position: OffsetTimestamp, Timestamp: timestamp}},
+		{name: "negative", offset: "-1", err: true},
+		{name: "unknown", offset: "yesterday", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_OFFSET", tt.offset)
+			t.Setenv("TEST_PARTITION_OFFSETS", "data-set-1/0=100,data-set-1/3=250")
+
+			actual := testOffsetConfig{}
+			err := load(&actual, []source{envSource{}})
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error for offset %q but got nil", tt.offset)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error loading config: %v", err)
+			}
+
+			if actual.offset.Position != tt.want.Position || actual.offset.Exact != tt.want.Exact ||
+				!actual.offset.Timestamp.Equal(tt.want.Timestamp) {
+				t.Fatalf("expected offset %+v but got %+v", tt.want, actual.offset)
+			}
+			if !actual.reset.IsZero() {
+				t.Fatalf("expected an unset reset offset but got %+v", actual.reset)
+			}
+
+			partitions, err := PartitionOffsets(actual.pinned)
+			if err != nil {
+				t.Fatalf("error parsing partition offsets: %v", err)
+			}
+			if partitions["data-set-1"][0] != 100 || partitions["data-set-1"][3] != 250 {
+				t.Fatalf("unexpected partition offsets %v", partitions)
+			}
+		})
+	}
+}
+
+func TestExplain(t *testing.T) {
+	unsetConfigEnv(t)
+	certPEM, keyPEM := testCertPEMs(t)
+
+	configPath := writeTestFile(t, t.TempDir(), "config.yaml", `
+stage: test
+messageQueue:
+  groupID: explain-group
+`)
+	t.Setenv(ConfigFileEnvName, configPath)
+	t.Setenv(SecretsDirEnvName, "")
+	t.Setenv("APP_NAME", "explain-test")
+	t.Setenv("MESSAGE_QUEUE_KEY", string(keyPEM))
+	t.Setenv("MESSAGE_QUEUE_CRT", string(certPEM))
+
+	entries, err := Explain()
+	if err == nil {
+		t.Fatal("expected an error for the missing config values but got nil")
+	}
+
+	expected := map[string]Entry{
+		"APP_NAME":                     {Name: "APP_NAME", Value: "explain-test", Source: "env"},
+		"MESSAGE_QUEUE_GROUP_ID":       {Name: "MESSAGE_QUEUE_GROUP_ID", Value: "explain-group", Source: "file"},
+		"MESSAGE_QUEUE_KEY":            {Name: "MESSAGE_QUEUE_KEY", Value: maskedValue, Source: "env"},
+		"MESSAGE_QUEUE_CRT":            {Name: "MESSAGE_QUEUE_CRT", Value: "PEM: CERTIFICATE", Source: "env"},
+		"OTEL_STDOUT_EXPORTER_ENABLED": {Name: "OTEL_STDOUT_EXPORTER_ENABLED", Value: "false", Source: "default"},
+		"MESSAGE_QUEUE_URL":            {Name: "MESSAGE_QUEUE_URL"},
+	}
+
+	for _, entry := range entries {
+		if want, ok := expected[entry.Name]; ok && entry != want {
+			t.Fatalf("unexpected entry - expected %+v but got %+v", want, entry)
+		}
+	}
+}
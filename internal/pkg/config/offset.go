@@ -0,0 +1,123 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Offset positions
+const (
+	OffsetEarliest  = "earliest"
+	OffsetLatest    = "latest"
+	OffsetNone      = "none"
+	OffsetTimestamp = "timestamp"
+	OffsetExact     = "exact"
+)
+
+// Offset is where a partition is consumed from. It's written as "earliest", "latest", "none",
+// an RFC 3339 timestamp (the first record produced at or after it) or an exact offset.
+// "none" doesn't consume partitions without a committed offset when used as a start offset,
+// and stops consuming a partition instead of resetting its offset when used as a reset offset.
+type Offset struct {
+	Position  string
+	Timestamp time.Time
+	Exact     int64
+}
+
+func (o *Offset) UnmarshalText(text []byte) error {
+	val := strings.TrimSpace(string(text))
+
+	switch val {
+	case OffsetEarliest, OffsetLatest, OffsetNone:
+		*o = Offset{Position: val}
+		return nil
+	}
+
+	if exact, err := strconv.ParseInt(val, 10, 64); err == nil {
+		if exact < 0 {
+			return fmt.Errorf("offset %d must not be negative", exact)
+		}
+		*o = Offset{Position: OffsetExact, Exact: exact}
+		return nil
+	}
+
+	timestamp, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return fmt.Errorf("%q is not one of %s, %s, %s, an RFC 3339 timestamp or an offset", val, OffsetEarliest, OffsetLatest, OffsetNone)
+	}
+	*o = Offset{Position: OffsetTimestamp, Timestamp: timestamp}
+
+	return nil
+}
+
+func (o Offset) String() string {
+	switch o.Position {
+	case OffsetTimestamp:
+		return o.Timestamp.Format(time.RFC3339)
+	case OffsetExact:
+		return strconv.FormatInt(o.Exact, 10)
+	default:
+		return o.Position
+	}
+}
+
+// IsZero reports whether the offset is unset
+func (o Offset) IsZero() bool {
+	return o.Position == ""
+}
+
+// PartitionOffsets returns the offsets of the "<topic>/<partition>" keys of offsets, by topic and partition
+func PartitionOffsets(offsets map[string]int64) (map[string]map[int32]int64, error) {
+	partitions := map[string]map[int32]int64{}
+
+	for key, offset := range offsets {
+		if offset < 0 {
+			return nil, fmt.Errorf("offset %d of %q must not be negative", offset, key)
+		}
+		err := addPartition(partitions, key, offset)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return partitions, nil
+}
+
+// Assignments returns the offsets of the "<topic>/<partition>" keys of assignments, by topic and partition
+func Assignments(assignments map[string]Offset) (map[string]map[int32]Offset, error) {
+	partitions := map[string]map[int32]Offset{}
+
+	for key, offset := range assignments {
+		// there are no committed offsets without a group
+		if offset.Position == OffsetNone {
+			return nil, fmt.Errorf("%q can't be assigned from offset %s", key, OffsetNone)
+		}
+		err := addPartition(partitions, key, offset)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return partitions, nil
+}
+
+// addPartition parses the "<topic>/<partition>" key and adds val to partitions under it
+func addPartition[T any](partitions map[string]map[int32]T, key string, val T) error {
+	topic, partitionStr, ok := strings.Cut(key, "/")
+	if !ok || topic == "" {
+		return fmt.Errorf("%q is not a <topic>/<partition> key", key)
+	}
+	partition, err := strconv.ParseInt(partitionStr, 10, 32)
+	if err != nil || partition < 0 {
+		return fmt.Errorf("%q has an invalid partition", key)
+	}
+
+	if partitions[topic] == nil {
+		partitions[topic] = map[int32]T{}
+	}
+	partitions[topic][int32(partition)] = val
+
+	return nil
+}
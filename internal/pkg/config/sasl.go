@@ -0,0 +1,47 @@
+package config
+
+import (
+	"fmt"
+)
+
+// SASL mechanisms supported by the kafka client
+const (
+	SASLPlain       = "PLAIN"
+	SASLScramSHA256 = "SCRAM-SHA-256"
+	SASLScramSHA512 = "SCRAM-SHA-512"
+	SASLOAuthBearer = "OAUTHBEARER"
+)
+
+// SASLConfig configures the SASL authentication of a kafka connection. SASL is disabled when
+// Mechanism is empty. PLAIN and SCRAM use Username and Password, OAUTHBEARER uses OAuthToken or
+// gets tokens from OAuthTokenURL with the client credentials grant.
+// Credentials are read on every new connection, so they can be rotated without a restart.
+type SASLConfig struct {
+	Mechanism         string   `envname:"MECHANISM" filekey:"mechanism" required:"false" validate:"oneof=PLAIN SCRAM-SHA-256 SCRAM-SHA-512 OAUTHBEARER"`
+	Username          string   `envname:"USERNAME" filekey:"username" required:"false" reload:"true"`
+	Password          string   `envname:"PASSWORD" secretfile:"password" filekey:"password" required:"false" secret:"true" reload:"true"`
+	OAuthToken        string   `envname:"OAUTH_TOKEN" secretfile:"token" filekey:"oauth.token" required:"false" secret:"true" reload:"true"`
+	OAuthTokenURL     string   `envname:"OAUTH_TOKEN_URL" filekey:"oauth.tokenURL" required:"false"`
+	OAuthClientID     string   `envname:"OAUTH_CLIENT_ID" filekey:"oauth.clientID" required:"false" reload:"true"`
+	OAuthClientSecret string   `envname:"OAUTH_CLIENT_SECRET" secretfile:"clientSecret" filekey:"oauth.clientSecret" required:"false" secret:"true" reload:"true"`
+	OAuthScopes       []string `envname:"OAUTH_SCOPES" filekey:"oauth.scopes" required:"false"`
+}
+
+// validateSASL checks that the credentials needed by the SASL mechanism are set
+func validateSASL(name string, sasl SASLConfig) []error {
+	var errs []error
+
+	switch sasl.Mechanism {
+	case SASLPlain, SASLScramSHA256, SASLScramSHA512:
+		if sasl.Username == "" || sasl.Password == "" {
+			errs = append(errs, fmt.Errorf("invalid %s SASL config: %s requires a username and password", name, sasl.Mechanism))
+		}
+	case SASLOAuthBearer:
+		clientCredentials := sasl.OAuthTokenURL != "" && sasl.OAuthClientID != "" && sasl.OAuthClientSecret != ""
+		if sasl.OAuthToken == "" && !clientCredentials {
+			errs = append(errs, fmt.Errorf("invalid %s SASL config: %s requires a token or a token URL, client ID and client secret", name, sasl.Mechanism))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,261 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// source provides the raw (string) value for a config field. Sources are checked in order
+// of precedence and the first one holding a value for a field wins.
+type source interface {
+	Name() string
+	Lookup(field reflect.StructField) (string, bool, error)
+}
+
+// newSources returns the config sources in order of precedence:
+// overrides > environment variables > mounted secret files > config file
+func newSources() ([]source, error) {
+	sources := []source{envSource{}}
+
+	overridesMu.RLock()
+	if len(overrides) > 0 {
+		sources = append([]source{overrideSource{values: overrides}}, sources...)
+	}
+	overridesMu.RUnlock()
+
+	if dir, ok := os.LookupEnv(SecretsDirEnvName); ok && dir != "" {
+		sources = append(sources, secretDirSource{dir: dir})
+	}
+
+	if path, ok := os.LookupEnv(ConfigFileEnvName); ok && path != "" {
+		fs, err := newFileSource(path)
+		if err != nil {
+			return nil, err
+		}
+
+		sources = append(sources, fs)
+	}
+
+	return sources, nil
+}
+
+var (
+	overridesMu sync.RWMutex
+	overrides   map[string]string
+)
+
+// Override sets config values by their environment variable names, taking precedence over every
+// other source, e.g. for command line flags. It must be called before the config is loaded.
+func Override(values map[string]string) error {
+	names := envNames(reflect.TypeFor[appConfig](), fieldPrefix{})
+
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		if !slices.Contains(names, name) {
+			errs = append(errs, fmt.Errorf("unknown config value %s", name))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	overridesMu.Lock()
+	overrides = maps.Clone(values)
+	overridesMu.Unlock()
+
+	return nil
+}
+
+// envNames returns the envname of every field of structType, nested ones included
+func envNames(structType reflect.Type, prefix fieldPrefix) []string {
+	var names []string
+	for i := range structType.NumField() {
+		field := prefix.apply(structType.Field(i))
+		if !isConfigField(field) {
+			continue
+		}
+
+		if isNestedStruct(field) {
+			names = append(names, envNames(field.Type, nestedPrefix(field))...)
+			continue
+		}
+		if name := field.Tag.Get("envname"); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// overrideSource reads the values set with Override, by the field's envname tag
+type overrideSource struct {
+	values map[string]string
+}
+
+func (overrideSource) Name() string {
+	return "flag"
+}
+
+func (ovs overrideSource) Lookup(field reflect.StructField) (string, bool, error) {
+	name := field.Tag.Get("envname")
+	if name == "" {
+		return "", false, nil
+	}
+
+	val, ok := ovs.values[name]
+	return val, ok, nil
+}
+
+// envSource reads the environment variable named by the field's envname tag
+type envSource struct{}
+
+func (envSource) Name() string {
+	return "env"
+}
+
+func (envSource) Lookup(field reflect.StructField) (string, bool, error) {
+	name := field.Tag.Get("envname")
+	if name == "" {
+		return "", false, nil
+	}
+
+	val, ok := os.LookupEnv(name)
+	return val, ok, nil
+}
+
+// secretDirSource reads the file named by the field's secretfile tag, relative to dir.
+// It's meant for kubernetes secrets mounted as volumes, where each key is its own file.
+type secretDirSource struct {
+	dir string
+}
+
+func (secretDirSource) Name() string {
+	return "secret"
+}
+
+func (sds secretDirSource) Lookup(field reflect.StructField) (string, bool, error) {
+	name := field.Tag.Get("secretfile")
+	if name == "" {
+		return "", false, nil
+	}
+
+	content, err := os.ReadFile(filepath.Join(sds.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("error reading secret file %q: %w", name, err)
+	}
+
+	// secrets created by hand often end with a newline that isn't part of the value
+	return strings.TrimRight(string(content), "\r\n"), true, nil
+}
+
+// fileSource reads the key named by the field's filekey tag from a YAML or JSON file.
+// Nested keys are separated by dots e.g. `filekey:"messageQueue.url"`
+type fileSource struct {
+	path   string
+	values map[string]any
+}
+
+func newFileSource(path string) (*fileSource, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file %q: %w", path, err)
+	}
+
+	values := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(content, &values)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &values)
+	default:
+		err = fmt.Errorf("unsupported config file extension %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %q: %w", path, err)
+	}
+
+	return &fileSource{path: path, values: values}, nil
+}
+
+func (*fileSource) Name() string {
+	return "file"
+}
+
+func (fs *fileSource) Lookup(field reflect.StructField) (string, bool, error) {
+	key := field.Tag.Get("filekey")
+	if key == "" {
+		return "", false, nil
+	}
+
+	var val any = fs.values
+	for _, part := range strings.Split(key, ".") {
+		nested, ok := val.(map[string]any)
+		if !ok {
+			return "", false, nil
+		}
+
+		val, ok = nested[part]
+		if !ok {
+			return "", false, nil
+		}
+	}
+
+	strVal, err := fileValueToString(val, separator(field))
+	if err != nil {
+		return "", false, fmt.Errorf("invalid value for key %q in config file %q: %w", key, fs.path, err)
+	}
+
+	return strVal, true, nil
+}
+
+// fileValueToString flattens scalars, lists and maps into the same string format
+// the environment variables use so they can be parsed by env.SetSep
+func fileValueToString(val any, sep string) (string, error) {
+	switch v := val.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case float64:
+		// JSON numbers decode as float64, which fmt prints as 1e+06 once large
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			strItem, err := fileValueToString(item, sep)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, strItem)
+		}
+
+		return strings.Join(items, sep), nil
+	case map[string]any:
+		items := make([]string, 0, len(v))
+		for key, item := range v {
+			strItem, err := fileValueToString(item, sep)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, key+"="+strItem)
+		}
+
+		return strings.Join(items, sep), nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
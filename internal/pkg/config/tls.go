@@ -0,0 +1,94 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rodney-b/swish-test-consumer/pkg/certs"
+)
+
+// TLSPolicy configures how a TLS connection is established, on top of the certificates used.
+// See the options in pkg/certs for what each field does.
+type TLSPolicy struct {
+	SystemRoots        bool     `envname:"SYSTEM_ROOTS" filekey:"systemRoots" default:"false"`
+	MinVersion         string   `envname:"MIN_VERSION" filekey:"minVersion" default:"1.2" validate:"oneof=1.0 1.1 1.2 1.3"`
+	MaxVersion         string   `envname:"MAX_VERSION" filekey:"maxVersion" required:"false" validate:"oneof=1.0 1.1 1.2 1.3"`
+	CipherSuites       []string `envname:"CIPHER_SUITES" filekey:"cipherSuites" required:"false"`
+	ServerName         string   `envname:"SERVER_NAME" filekey:"serverName" required:"false"`
+	SPKIPins           []string `envname:"SPKI_PINS" filekey:"spkiPins" required:"false"`
+	InsecureSkipVerify bool     `envname:"INSECURE_SKIP_VERIFY" filekey:"insecureSkipVerify" default:"false"`
+}
+
+// CertOptions returns the pkg/certs options implementing the policy
+func (tp TLSPolicy) CertOptions() ([]certs.Option, error) {
+	var opts []certs.Option
+
+	if tp.SystemRoots {
+		opts = append(opts, certs.WithSystemRoots())
+	}
+
+	var minVersion uint16
+	if tp.MinVersion != "" {
+		var err error
+		minVersion, err = certs.ParseVersion(tp.MinVersion)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, certs.WithMinVersion(minVersion))
+	}
+
+	if tp.MaxVersion != "" {
+		maxVersion, err := certs.ParseVersion(tp.MaxVersion)
+		if err != nil {
+			return nil, err
+		}
+		if maxVersion < minVersion {
+			return nil, fmt.Errorf("max TLS version %s is lower than the min version %s", tp.MaxVersion, tp.MinVersion)
+		}
+		opts = append(opts, certs.WithMaxVersion(maxVersion))
+	}
+
+	if len(tp.CipherSuites) > 0 {
+		ids, err := certs.ParseCipherSuites(tp.CipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, certs.WithCipherSuites(ids...))
+	}
+
+	if tp.ServerName != "" {
+		opts = append(opts, certs.WithServerName(tp.ServerName))
+	}
+
+	if len(tp.SPKIPins) > 0 {
+		opts = append(opts, certs.WithSPKIPins(tp.SPKIPins...))
+	}
+
+	if tp.InsecureSkipVerify {
+		opts = append(opts, certs.WithInsecureSkipVerify())
+	}
+
+	return opts, nil
+}
+
+// validateTLS checks that a TLS config can be created from the policy and PEMs.
+// Skipping the server verification is only allowed in development stages.
+func validateTLS(name string, policy TLSPolicy, isDevelopment bool, material certs.Material) []error {
+	var errs []error
+
+	if policy.InsecureSkipVerify && !isDevelopment {
+		errs = append(errs, fmt.Errorf("invalid %s TLS policy: insecure skip verify is only allowed in development stages", name))
+	}
+
+	opts, err := policy.CertOptions()
+	if err != nil {
+		return append(errs, fmt.Errorf("invalid %s TLS policy: %w", name, err))
+	}
+
+	_, err = certs.NewTLSConfigFromMaterial(material, opts...)
+	if err != nil {
+		errs = append(errs, errors.Join(fmt.Errorf("invalid %s TLS certificates", name), err))
+	}
+
+	return errs
+}
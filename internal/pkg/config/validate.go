@@ -0,0 +1,169 @@
+package config
+
+import (
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// rule checks a single config value. arg is whatever follows the "=" in the rule's tag e.g. `validate:"oneof=a b"`
+type rule func(val reflect.Value, arg string) error
+
+// rules are applied to the fields tagged with their names e.g. `validate:"hostport"`.
+// Several rules can be applied to a field by separating them with commas.
+// Rules other than notempty skip empty values, so optional fields are only checked when set.
+var rules = map[string]rule{
+	"notempty": func(val reflect.Value, _ string) error {
+		if val.IsZero() || (val.Kind() == reflect.Slice && val.Len() == 0) {
+			return errors.New("must not be empty")
+		}
+		return nil
+	},
+	"hostport": func(val reflect.Value, _ string) error {
+		for _, addr := range stringValues(val) {
+			host, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return fmt.Errorf("%q is not a valid host:port: %w", addr, err)
+			}
+			if host == "" {
+				return fmt.Errorf("%q is missing a host", addr)
+			}
+			if err := validPort(port); err != nil {
+				return fmt.Errorf("%q has an invalid port: %w", addr, err)
+			}
+		}
+		return nil
+	},
+	"positive": func(val reflect.Value, _ string) error {
+		positive := true
+		switch {
+		case val.CanInt():
+			positive = val.Int() > 0
+		case val.CanFloat():
+			positive = val.Float() > 0
+		}
+		if !positive {
+			return fmt.Errorf("%v must be positive", val.Interface())
+		}
+		return nil
+	},
+	"regexp": func(val reflect.Value, _ string) error {
+		for _, expr := range stringValues(val) {
+			if _, err := regexp.Compile(expr); err != nil {
+				return fmt.Errorf("%q is not a valid regular expression: %w", expr, err)
+			}
+		}
+		return nil
+	},
+	"port": func(val reflect.Value, _ string) error {
+		return validPort(fmt.Sprint(val.Interface()))
+	},
+	"oneof": func(val reflect.Value, arg string) error {
+		allowed := strings.Fields(arg)
+		for _, item := range stringValues(val) {
+			if !slices.Contains(allowed, item) {
+				return fmt.Errorf("%q must be one of %v", item, allowed)
+			}
+		}
+		return nil
+	},
+	"pem": func(val reflect.Value, _ string) error {
+		block, _ := pem.Decode(val.Bytes())
+		if block == nil {
+			return errors.New("no PEM data found")
+		}
+		return nil
+	},
+}
+
+// validate checks the fields of the struct pointed to by src against their validate tags,
+// then runs the struct's own cross-field checks if it has any (see validator).
+// Every problem found is reported in the returned error.
+func validate(src any) error {
+	errs := validateStruct(reflect.ValueOf(src).Elem(), fieldPrefix{})
+
+	if v, ok := src.(validator); ok {
+		errs = append(errs, v.validate()...)
+	}
+
+	return errors.Join(errs...)
+}
+
+// validator is implemented by config structs with rules spanning several fields
+type validator interface {
+	validate() []error
+}
+
+func validateStruct(structVal reflect.Value, prefix fieldPrefix) []error {
+	structType := structVal.Type()
+	var errs []error
+
+	for i := range structVal.NumField() {
+		fieldInfo := prefix.apply(structType.Field(i))
+		if !isConfigField(fieldInfo) {
+			continue
+		}
+
+		fieldValue := structVal.Field(i)
+		unsafeFieldValue := reflect.NewAt(fieldValue.Type(), fieldValue.Addr().UnsafePointer()).Elem()
+
+		if isNestedStruct(fieldInfo) {
+			errs = append(errs, validateStruct(unsafeFieldValue, nestedPrefix(fieldInfo))...)
+			continue
+		}
+
+		tag := fieldInfo.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+
+		for _, ruleTag := range strings.Split(tag, ",") {
+			name, arg, _ := strings.Cut(ruleTag, "=")
+			check, ok := rules[name]
+			if !ok {
+				errs = append(errs, fmt.Errorf("unknown validation rule %q for %s", name, describeField(fieldInfo)))
+				continue
+			}
+
+			if name != "notempty" && unsafeFieldValue.IsZero() {
+				continue
+			}
+
+			if err := check(unsafeFieldValue, arg); err != nil {
+				errs = append(errs, fmt.Errorf("invalid config value for %s: %w", describeField(fieldInfo), err))
+			}
+		}
+	}
+
+	return errs
+}
+
+// stringValues returns the string, or strings of a slice, held by val
+func stringValues(val reflect.Value) []string {
+	if val.Kind() == reflect.Slice {
+		items := make([]string, 0, val.Len())
+		for i := range val.Len() {
+			items = append(items, fmt.Sprint(val.Index(i).Interface()))
+		}
+		return items
+	}
+
+	return []string{fmt.Sprint(val.Interface())}
+}
+
+func validPort(port string) error {
+	portNum, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return err
+	}
+	if portNum == 0 {
+		return errors.New("port must be between 1 and 65535")
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type testValidateConfig struct {
+	brokers []string `envname:"TEST_BROKERS" validate:"notempty,hostport"`
+	port    uint16   `envname:"TEST_PORT" validate:"port"`
+	stage   string   `envname:"TEST_STAGE" validate:"oneof=production staging"`
+	ca      []byte   `envname:"TEST_CA" validate:"pem"`
+	rack    string   `envname:"TEST_RACK" validate:"hostport"`
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   testValidateConfig
+		wantErrs int
+	}{
+		{
+			name: "valid config",
+			config: testValidateConfig{
+				brokers: []string{"kafka-0.kafka:9093", "kafka-1.kafka:9093"},
+				port:    50051,
+				stage:   Staging,
+				ca:      []byte("-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"),
+			},
+		},
+		{
+			name:     "empty required list",
+			config:   testValidateConfig{},
+			wantErrs: 1,
+		},
+		{
+			name: "every field invalid",
+			config: testValidateConfig{
+				brokers: []string{"kafka-0.kafka:9093", "kafka-1.kafka"},
+				stage:   Local,
+				ca:      []byte("not a pem"),
+				rack:    ":80",
+			},
+			wantErrs: 4,
+		},
+		{
+			name: "invalid port",
+			config: testValidateConfig{
+				brokers: []string{"localhost:70000"},
+			},
+			wantErrs: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate(&tt.config)
+			if tt.wantErrs == 0 {
+				if err != nil {
+					t.Fatalf("unexpected validation error: %v", err)
+				}
+				return
+			}
+
+			var joinErr interface{ Unwrap() []error }
+			if !errors.As(err, &joinErr) || len(joinErr.Unwrap()) != tt.wantErrs {
+				t.Fatalf("expected %d validation errors but got: %v", tt.wantErrs, err)
+			}
+		})
+	}
+}
+
+func TestValidateAppConfig(t *testing.T) {
+	ac := appConfig{
+		certExpiryCheckInterval:   time.Hour,
+		dedup:                     DedupConfig{Store: DedupMemory, Size: 100, TTL: time.Hour},
+		handler:                   HandlerConfig{BatchSize: 100, BatchTimeout: time.Second},
+		healthcheckPort:           50051,
+		healthcheckServicePrefix:  "test",
+		messageQueueGroupID:       "group",
+		messageQueueOptions:       validKafkaOptions(),
+		messageQueueTLSEnabled:    true,
+		messageQueueTopics:        []string{"topic"},
+		messageQueueURLs:          []string{"localhost"},
+		otelStdoutExporterEnabled: true,
+		stage:                     "prod",
+	}
+
+	// invalid url, unknown stage, missing message queue CA
+	err := validate(&ac)
+	var joinErr interface{ Unwrap() []error }
+	if !errors.As(err, &joinErr) || len(joinErr.Unwrap()) != 3 {
+		t.Fatalf("expected 3 validation errors but got: %v", err)
+	}
+
+	// skipping verification outside of development stages
+	ac.stage = Production
+	ac.messageQueueURLs = []string{"localhost:9092", "127.0.0.1:9093"}
+	ac.messageQueueClientCA, _ = testCertPEMs(t)
+	ac.messageQueueTLSPolicy = TLSPolicy{MinVersion: "1.3", MaxVersion: "1.2", InsecureSkipVerify: true}
+	err = validate(&ac)
+	if !errors.As(err, &joinErr) || len(joinErr.Unwrap()) != 2 {
+		t.Fatalf("expected 2 validation errors but got: %v", err)
+	}
+
+	ac.messageQueueTLSPolicy = TLSPolicy{MinVersion: "1.2", SPKIPins: []string{"bm90IGEgaGFzaA=="}}
+	err = validate(&ac)
+	if err == nil {
+		t.Fatal("expected an invalid SPKI pin error but got nil")
+	}
+
+	// the TLS policy and certificates aren't used without TLS
+	ac.messageQueueTLSEnabled = false
+	err = validate(&ac)
+	if err != nil {
+		t.Fatalf("unexpected validation error without TLS: %v", err)
+	}
+	ac.messageQueueTLSEnabled = true
+
+	ac.messageQueueTLSPolicy = TLSPolicy{MinVersion: "1.2", CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}}
+	err = validate(&ac)
+	if err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	saslTests := []struct {
+		name  string
+		sasl  SASLConfig
+		valid bool
+	}{
+		{name: "disabled", sasl: SASLConfig{}, valid: true},
+		{name: "unknown mechanism", sasl: SASLConfig{Mechanism: "GSSAPI"}},
+		{name: "scram", sasl: SASLConfig{Mechanism: SASLScramSHA512, Username: "user", Password: "pass"}, valid: true},
+		{name: "plain without password", sasl: SASLConfig{Mechanism: SASLPlain, Username: "user"}},
+		{name: "oauth token", sasl: SASLConfig{Mechanism: SASLOAuthBearer, OAuthToken: "token"}, valid: true},
+		{name: "oauth client credentials", sasl: SASLConfig{
+			Mechanism: SASLOAuthBearer, OAuthTokenURL: "https://auth/token", OAuthClientID: "id", OAuthClientSecret: "secret",
+		}, valid: true},
+		{name: "oauth without client secret", sasl: SASLConfig{Mechanism: SASLOAuthBearer, OAuthTokenURL: "https://auth/token", OAuthClientID: "id"}},
+	}
+
+	for _, tt := range saslTests {
+		t.Run("SASL "+tt.name, func(t *testing.T) {
+			ac.messageQueueSASL = tt.sasl
+			err := validate(&ac)
+			if tt.valid && err != nil {
+				t.Fatalf("unexpected validation error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatal("expected a validation error but got nil")
+			}
+		})
+	}
+	ac.messageQueueSASL = SASLConfig{}
+
+	dedupTests := []struct {
+		name  string
+		dedup DedupConfig
+		errs  int
+	}{
+		{name: "disabled", dedup: DedupConfig{Store: DedupMemory, Size: 100, TTL: time.Hour}},
+		{name: "key", dedup: DedupConfig{Extractor: DedupKey, Store: DedupMemory, Size: 100, TTL: time.Hour}},
+		{name: "header without field", dedup: DedupConfig{Extractor: DedupHeader, Store: DedupMemory, Size: 100, TTL: time.Hour}, errs: 1},
+		{name: "disk without path", dedup: DedupConfig{Extractor: DedupJSON, Field: "id", Store: DedupDisk, Size: 100, TTL: time.Hour}, errs: 1},
+		{name: "unknown store", dedup: DedupConfig{Extractor: DedupKey, Store: "redis", Size: 100, TTL: time.Hour}, errs: 1},
+	}
+
+	for _, tt := range dedupTests {
+		t.Run("dedup "+tt.name, func(t *testing.T) {
+			ac.dedup = tt.dedup
+			err := validate(&ac)
+			if tt.errs == 0 {
+				if err != nil {
+					t.Fatalf("unexpected validation error: %v", err)
+				}
+				return
+			}
+			if !errors.As(err, &joinErr) || len(joinErr.Unwrap()) != tt.errs {
+				t.Fatalf("expected %d validation errors but got: %v", tt.errs, err)
+			}
+		})
+	}
+	ac.dedup = DedupConfig{Store: DedupMemory, Size: 100, TTL: time.Hour}
+
+	ac.messageQueueTopics = []string{"data-set-1,data-set-2"}
+	if err := validate(&ac); err == nil {
+		t.Fatal("expected a comma separated topics error but got nil")
+	}
+	ac.messageQueueTopics = []string{"topic"}
+
+	ac.handler.BatchTimeout = ac.messageQueueOptions.RebalanceTimeout
+	if err := validate(&ac); err == nil {
+		t.Fatal("expected a batch timeout error but got nil")
+	}
+	ac.handler.BatchTimeout = time.Second
+
+	optionsTests := []struct {
+		name   string
+		modify func(*KafkaOptions)
+		errs   int
+	}{
+		{name: "valid", modify: func(*KafkaOptions) {}},
+		{name: "negative fetch max bytes", modify: func(o *KafkaOptions) { o.FetchMaxBytes = -1 }, errs: 2},
+		{name: "zero max wait", modify: func(o *KafkaOptions) { o.FetchMaxWait = 0 }, errs: 1},
+		{name: "unknown isolation level", modify: func(o *KafkaOptions) { o.IsolationLevel = "read_all" }, errs: 1},
+		{name: "eager balancers", modify: func(o *KafkaOptions) { o.Balancers = []string{RangeBalancer, StickyBalancer} }},
+		{name: "cooperative migration balancers", modify: func(o *KafkaOptions) { o.Balancers = []string{CooperativeStickyBalancer, RangeBalancer} }},
+		{name: "unknown balancer", modify: func(o *KafkaOptions) { o.Balancers = []string{"random"} }, errs: 1},
+		{name: "heartbeat after session timeout", modify: func(o *KafkaOptions) { o.HeartbeatInterval = time.Minute }, errs: 1},
+		{name: "regex topics", modify: func(o *KafkaOptions) {
+			o.TopicsRegex = true
+			o.ExcludeTopics = []string{"^__.*", "-dlq$"}
+		}},
+		{name: "invalid exclude regex", modify: func(o *KafkaOptions) {
+			o.TopicsRegex = true
+			o.ExcludeTopics = []string{"data-set-(1"}
+		}, errs: 1},
+		{name: "partition offsets", modify: func(o *KafkaOptions) { o.PartitionOffsets = map[string]int64{"data-set-1/0": 42} }},
+		{name: "invalid partition offsets", modify: func(o *KafkaOptions) { o.PartitionOffsets = map[string]int64{"data-set-1": 42} }, errs: 1},
+		{name: "assignments", modify: func(o *KafkaOptions) {
+			o.Assignments = map[string]Offset{"data-set-1/0": {Position: OffsetExact, Exact: 42}, "data-set-2/1": {Position: OffsetLatest}}
+		}},
+		{name: "assignments from committed offsets", modify: func(o *KafkaOptions) {
+			o.Assignments = map[string]Offset{"data-set-1/0": {Position: OffsetNone}}
+		}, errs: 1},
+		{name: "assignments with regex topics", modify: func(o *KafkaOptions) {
+			o.TopicsRegex = true
+			o.Assignments = map[string]Offset{"data-set-1/0": {Position: OffsetEarliest}}
+		}, errs: 1},
+		{name: "exclude without regex topics", modify: func(o *KafkaOptions) { o.ExcludeTopics = []string{"-dlq$"} }, errs: 1},
+		{name: "transactional", modify: func(o *KafkaOptions) { o.Transactional = true; o.OutputTopic = "data-set-out" }},
+		{name: "transactional with assignments", modify: func(o *KafkaOptions) {
+			o.Transactional = true
+			o.Assignments = map[string]Offset{"data-set-1/0": {Position: OffsetEarliest}}
+		}, errs: 1},
+		{name: "retry delays", modify: func(o *KafkaOptions) { o.RetryDelays = []time.Duration{time.Minute, 10 * time.Minute} }},
+		{name: "invalid retry delays", modify: func(o *KafkaOptions) { o.RetryDelays = []time.Duration{time.Minute, 0, time.Minute} }, errs: 2},
+		{name: "transactional retries", modify: func(o *KafkaOptions) {
+			o.Transactional = true
+			o.RetryDelays = []time.Duration{time.Minute}
+		}, errs: 1},
+		{name: "unknown partitioner", modify: func(o *KafkaOptions) { o.Partitioner = "random" }, errs: 1},
+		{name: "zero transaction timeout", modify: func(o *KafkaOptions) { o.TransactionTimeout = 0 }, errs: 1},
+	}
+
+	for _, tt := range optionsTests {
+		t.Run("options "+tt.name, func(t *testing.T) {
+			ac.messageQueueOptions = validKafkaOptions()
+			tt.modify(&ac.messageQueueOptions)
+			err := validate(&ac)
+			if tt.errs == 0 {
+				if err != nil {
+					t.Fatalf("unexpected validation error: %v", err)
+				}
+				return
+			}
+			if !errors.As(err, &joinErr) || len(joinErr.Unwrap()) != tt.errs {
+				t.Fatalf("expected %d validation errors but got: %v", tt.errs, err)
+			}
+		})
+	}
+}
+
+// validKafkaOptions returns the default kafka options
+func validKafkaOptions() KafkaOptions {
+	return KafkaOptions{
+		FetchMaxBytes:          50 << 20,
+		FetchMaxPartitionBytes: 1 << 20,
+		FetchMinBytes:          1,
+		FetchMaxWait:           5 * time.Second,
+		IsolationLevel:         ReadUncommitted,
+		Balancers:              []string{CooperativeStickyBalancer},
+		SessionTimeout:         45 * time.Second,
+		HeartbeatInterval:      3 * time.Second,
+		RebalanceTimeout:       time.Minute,
+		MetadataMaxAge:         5 * time.Minute,
+		TransactionTimeout:     40 * time.Second,
+		Partitioner:            UniformBytesPartitioner,
+	}
+}
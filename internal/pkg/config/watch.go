@@ -0,0 +1,229 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDebounce groups the burst of file events caused by a single update
+// e.g. kubernetes swapping the ..data symlink of a mounted secret
+const reloadDebounce = time.Second
+
+// Change describes the fields (by name, see fieldName) whose values changed on reload
+type Change struct {
+	// Applied changes are visible through the ConfigProvider getters
+	Applied []string
+	// RestartRequired changes aren't safe to apply at runtime and are ignored until the app restarts
+	RestartRequired []string
+}
+
+// Has reports whether the value of the field named name was applied
+func (c Change) Has(name string) bool {
+	return slices.Contains(c.Applied, name)
+}
+
+// Subscriber is notified after every reload that changed the config
+type Subscriber func(cp ConfigProvider, change Change)
+
+// Watcher re-reads the config sources when the config file or the mounted secrets change,
+// or when the process receives a SIGHUP. Only fields tagged `reload:"true"` are updated,
+// every other change is reported as requiring a restart.
+//
+// Subscribers are registered with ConfigProvider.Subscribe.
+type Watcher struct {
+	ac  *appConfig
+	log *slog.Logger
+}
+
+// NewWatcher returns a Watcher for the config returned by InitAppConfig
+func NewWatcher(log *slog.Logger) (*Watcher, error) {
+	ac, err := initAppConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Watcher{ac: ac, log: log}, nil
+}
+
+// Run watches for changes until ctx is cancelled
+func (w *Watcher) Run(ctx context.Context) error {
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Join(errors.New("error creating config file watcher"), err)
+	}
+	defer fsWatcher.Close()
+
+	for _, path := range watchedPaths() {
+		err = fsWatcher.Add(path)
+		if err != nil {
+			return fmt.Errorf("error watching config path %q: %w", path, err)
+		}
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	debounce := time.NewTimer(reloadDebounce)
+	debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hangup:
+			w.log.Info("SIGHUP received - reloading config")
+			w.reloadAndLog()
+		case event, ok := <-fsWatcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Chmod) {
+				continue
+			}
+			debounce.Reset(reloadDebounce)
+		case err, ok := <-fsWatcher.Errors:
+			if !ok {
+				return nil
+			}
+			w.log.Error("config watcher error", "error", err.Error())
+		case <-debounce.C:
+			w.log.Info("config sources changed - reloading config")
+			w.reloadAndLog()
+		}
+	}
+}
+
+func (w *Watcher) reloadAndLog() {
+	change, err := w.Reload()
+	if err != nil {
+		w.log.Error("error reloading config - keeping the current config", "error", err.Error())
+		return
+	}
+
+	if len(change.Applied) > 0 {
+		w.log.Info("config changes applied", "fields", change.Applied)
+	}
+	if len(change.RestartRequired) > 0 {
+		w.log.Warn("config changes require a restart to be applied", "fields", change.RestartRequired)
+	}
+}
+
+// Reload re-reads and validates the config, applies the changes that are safe at runtime
+// and notifies the subscribers. The current config is left untouched if the new one is invalid.
+func (w *Watcher) Reload() (Change, error) {
+	sources, err := newSources()
+	if err != nil {
+		return Change{}, err
+	}
+
+	newAC := appConfig{}
+	err = load(&newAC, sources)
+	if err != nil {
+		return Change{}, err
+	}
+
+	err = validate(&newAC)
+	if err != nil {
+		return Change{}, err
+	}
+
+	w.ac.mu.Lock()
+	change := applyChanges(reflect.ValueOf(w.ac).Elem(), reflect.ValueOf(&newAC).Elem(), fieldPrefix{})
+	w.ac.mu.Unlock()
+
+	if len(change.Applied) == 0 && len(change.RestartRequired) == 0 {
+		return change, nil
+	}
+
+	w.ac.notify(change)
+
+	return change, nil
+}
+
+// applyChanges copies the changed reloadable fields of newVal into curVal.
+// The caller must hold the config's lock.
+func applyChanges(curVal, newVal reflect.Value, prefix fieldPrefix) Change {
+	structType := curVal.Type()
+	change := Change{}
+
+	for i := range curVal.NumField() {
+		fieldInfo := prefix.apply(structType.Field(i))
+		if !isConfigField(fieldInfo) {
+			continue
+		}
+
+		curField := curVal.Field(i)
+		unsafeCurField := reflect.NewAt(curField.Type(), curField.Addr().UnsafePointer()).Elem()
+		newField := newVal.Field(i)
+		unsafeNewField := reflect.NewAt(newField.Type(), newField.Addr().UnsafePointer()).Elem()
+
+		if isNestedStruct(fieldInfo) {
+			nestedChange := applyChanges(unsafeCurField, unsafeNewField, nestedPrefix(fieldInfo))
+			change.Applied = append(change.Applied, nestedChange.Applied...)
+			change.RestartRequired = append(change.RestartRequired, nestedChange.RestartRequired...)
+			continue
+		}
+
+		if reflect.DeepEqual(unsafeCurField.Interface(), unsafeNewField.Interface()) {
+			continue
+		}
+
+		if reloadable, _ := strconv.ParseBool(fieldInfo.Tag.Get("reload")); !reloadable {
+			change.RestartRequired = append(change.RestartRequired, fieldName(fieldInfo))
+			continue
+		}
+
+		unsafeCurField.Set(unsafeNewField)
+		change.Applied = append(change.Applied, fieldName(fieldInfo))
+	}
+
+	return change
+}
+
+// fieldName returns the name used to refer to a config field outside the config package,
+// which is its environment variable name
+func fieldName(field reflect.StructField) string {
+	if name := field.Tag.Get("envname"); name != "" {
+		return name
+	}
+
+	return field.Name
+}
+
+// watchedPaths returns the directories holding the config file and the mounted secrets.
+// Directories are watched rather than files since kubernetes updates mounted configmaps
+// and secrets by swapping symlinks.
+func watchedPaths() []string {
+	var paths []string
+
+	if path := os.Getenv(ConfigFileEnvName); path != "" {
+		paths = append(paths, filepath.Dir(path))
+	}
+
+	if dir := os.Getenv(SecretsDirEnvName); dir != "" {
+		paths = append(paths, dir)
+
+		// each secret is usually mounted in its own subdirectory
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			if entry.IsDir() {
+				paths = append(paths, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+
+	return paths
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testCertPEMs returns a self signed certificate (used as its own CA) and its key
+func testCertPEMs(t *testing.T) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "config-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("error marshalling key: %v", err)
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM
+}
+
+// unsetConfigEnv unsets the env vars of appConfig for the duration of the test since they
+// take precedence over the other sources
+func unsetConfigEnv(t *testing.T) {
+	acType := reflect.TypeFor[appConfig]()
+	for i := range acType.NumField() {
+		if name := acType.Field(i).Tag.Get("envname"); name != "" {
+			t.Setenv(name, "")
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+	unsetConfigEnv(t)
+	certPEM, keyPEM := testCertPEMs(t)
+	secretsDir := t.TempDir()
+	for _, dir := range []string{"message-queue-ca", "message-queue"} {
+		if err := os.Mkdir(filepath.Join(secretsDir, dir), 0o700); err != nil {
+			t.Fatalf("error creating secrets dir: %v", err)
+		}
+	}
+	writeTestFile(t, filepath.Join(secretsDir, "message-queue-ca"), "ca.crt", string(certPEM))
+	writeTestFile(t, filepath.Join(secretsDir, "message-queue"), "user.crt", string(certPEM))
+	writeTestFile(t, filepath.Join(secretsDir, "message-queue"), "user.key", string(keyPEM))
+
+	configPath := writeTestFile(t, t.TempDir(), "config.yaml", `
+appName: reload-test
+stage: test
+logLevel: debug
+healthcheck:
+  servicePrefix: reload-test
+messageQueue:
+  groupID: reload-group
+  url: localhost:9092
+  topics: [data-set-1, data-set-2]
+otel:
+  httpReceiverURL: localhost:4318
+  stdoutExporterEnabled: true
+`)
+	t.Setenv(SecretsDirEnvName, secretsDir)
+	t.Setenv(ConfigFileEnvName, configPath)
+
+	ac := appConfig{
+		appName:             "reload-test",
+		stage:               Test,
+		logLevel:            "info",
+		messageQueueGroupID: "reload-group",
+		messageQueueTopics:  []string{"data-set-1"},
+	}
+
+	var notified []Change
+	w := &Watcher{ac: &ac}
+	ac.Subscribe(func(cp ConfigProvider, change Change) {
+		notified = append(notified, change)
+	})
+	unsubscribe := ac.Subscribe(func(cp ConfigProvider, change Change) {
+		t.Fatal("unsubscribed subscriber notified")
+	})
+	unsubscribe()
+
+	change, err := w.Reload()
+	if err != nil {
+		t.Fatalf("error reloading config: %v", err)
+	}
+
+	if !change.Has("LOG_LEVEL") || !change.Has("MESSAGE_QUEUE_TOPICS") {
+		t.Fatalf("expected LOG_LEVEL and MESSAGE_QUEUE_TOPICS to be applied but got %+v", change)
+	}
+	if !slices.Contains(change.RestartRequired, "MESSAGE_QUEUE_URL") || slices.Contains(change.RestartRequired, "APP_NAME") {
+		t.Fatalf("expected MESSAGE_QUEUE_URL (but not APP_NAME) to require a restart but got %+v", change)
+	}
+	if ac.GetLogLevel() != "debug" || len(ac.GetMessageQueueTopics()) != 2 {
+		t.Fatalf("reloadable values weren't applied: log level %q, topics %v", ac.GetLogLevel(), ac.GetMessageQueueTopics())
+	}
+	if len(ac.GetMessageQueueURLs()) != 0 {
+		t.Fatalf("values requiring a restart shouldn't be applied but urls are %v", ac.GetMessageQueueURLs())
+	}
+	if len(notified) != 1 {
+		t.Fatalf("expected subscribers to be notified once but got %d notifications", len(notified))
+	}
+
+	// an invalid config is rejected and the current one kept
+	writeTestFile(t, filepath.Dir(configPath), "config.yaml", "logLevel: verbose\n")
+	_, err = w.Reload()
+	if err == nil {
+		t.Fatal("expected an error reloading an invalid config but got nil")
+	}
+	if ac.GetLogLevel() != "debug" {
+		t.Fatalf("invalid reload changed the log level to %q", ac.GetLogLevel())
+	}
+}
@@ -0,0 +1,239 @@
+package dedup
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/handler"
+)
+
+// Store keeps the IDs of the records processed
+type Store interface {
+	// Seen reports whether id was marked as processed and hasn't expired
+	Seen(ctx context.Context, id string) (bool, error)
+	// Mark marks ids as processed
+	Mark(ctx context.Context, ids ...string) error
+	Close() error
+}
+
+// Deduplicator skips the records already processed, as identified by an extractor. IDs are
+// scoped to the topic of the records.
+//
+// The records handled are only marked as processed once their offsets are committed (see
+// Commit) so a record is never skipped because it was handled by a failed attempt, e.g. an
+// aborted transaction or a crash before its output was produced.
+type Deduplicator struct {
+	extract Extractor
+	store   Store
+	log     *slog.Logger
+
+	mu      sync.Mutex
+	pending map[string]struct{}
+}
+
+// New returns a deduplicator identifying records with extract and keeping their IDs in store
+func New(extract Extractor, store Store, log *slog.Logger) *Deduplicator {
+	return &Deduplicator{
+		extract: extract,
+		store:   store,
+		log:     log,
+		pending: make(map[string]struct{}),
+	}
+}
+
+// Wrap returns a handler skipping the records already processed, and passing the others to next.
+// Records that can't be identified are passed to next.
+func (d *Deduplicator) Wrap(next handler.Handler) handler.Handler {
+	return handler.Func(func(ctx context.Context, r *kgo.Record) error {
+		id := d.id(r)
+		if id == "" {
+			return next.Handle(ctx, r)
+		}
+
+		seen, err := d.seen(ctx, id)
+		if err != nil {
+			return errors.Join(errors.New("error checking the dedup store"), err)
+		}
+		if seen {
+			d.log.Debug("duplicate record skipped", "topic", r.Topic, "partition", r.Partition, "offset", r.Offset, "id", id)
+			return nil
+		}
+
+		err = next.Handle(ctx, r)
+		if err != nil {
+			return err
+		}
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.pending[id] = struct{}{}
+		return nil
+	})
+}
+
+// WrapBatch returns a batch handler skipping the records already processed, or duplicated in the
+// batch, and passing the others to next. Records that can't be identified are passed to next, and
+// records that can't be checked against the store fail without being handled.
+func (d *Deduplicator) WrapBatch(next handler.BatchHandler) handler.BatchHandler {
+	return handler.BatchFunc(func(ctx context.Context, records []*kgo.Record) error {
+		unseen := make([]*kgo.Record, 0, len(records))
+		ids := make(map[*kgo.Record]string, len(records))
+		inBatch := make(map[string]struct{}, len(records))
+		unchecked := &handler.BatchError{}
+		for _, r := range records {
+			id := d.id(r)
+			if id == "" {
+				unseen = append(unseen, r)
+				continue
+			}
+
+			if _, duplicate := inBatch[id]; duplicate {
+				d.log.Debug("duplicate record skipped", "topic", r.Topic, "partition", r.Partition, "offset", r.Offset, "id", id)
+				continue
+			}
+			seen, err := d.seen(ctx, id)
+			if err != nil {
+				unchecked.Fail(r, errors.Join(errors.New("error checking the dedup store"), err))
+				inBatch[id] = struct{}{}
+				continue
+			}
+			if seen {
+				d.log.Debug("duplicate record skipped", "topic", r.Topic, "partition", r.Partition, "offset", r.Offset, "id", id)
+				continue
+			}
+			ids[r] = id
+			inBatch[id] = struct{}{}
+			unseen = append(unseen, r)
+		}
+		if len(unseen) == 0 {
+			return unchecked.Err()
+		}
+
+		err := next.HandleBatch(ctx, unseen)
+		failures := handler.Failures(unseen, err)
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		for r, id := range ids {
+			if !slices.ContainsFunc(failures, func(f handler.Failure) bool { return f.Record == r }) {
+				d.pending[id] = struct{}{}
+			}
+		}
+
+		if len(unchecked.Failures) == 0 {
+			return err
+		}
+		// failures are reported in offset order, like the records of the batch
+		unchecked.Failures = append(unchecked.Failures, failures...)
+		slices.SortStableFunc(unchecked.Failures, func(a, b handler.Failure) int {
+			return cmp.Compare(a.Record.Offset, b.Record.Offset)
+		})
+		return unchecked
+	})
+}
+
+// id returns the ID of r scoped to its topic, or an empty ID if r can't be identified
+func (d *Deduplicator) id(r *kgo.Record) string {
+	id, err := d.extract(r)
+	if err != nil {
+		d.log.Warn("error extracting the record ID - record not deduplicated",
+			"topic", r.Topic, "partition", r.Partition, "offset", r.Offset, "error", err.Error())
+		return ""
+	}
+	if id == "" {
+		return ""
+	}
+
+	return r.Topic + "/" + id
+}
+
+// seen reports whether id was processed, or handled since the last commit
+func (d *Deduplicator) seen(ctx context.Context, id string) (bool, error) {
+	d.mu.Lock()
+	_, pending := d.pending[id]
+	d.mu.Unlock()
+	if pending {
+		return true, nil
+	}
+
+	return d.store.Seen(ctx, id)
+}
+
+// Commit marks the records handled since the last commit or discard as processed. It must be
+// called once their offsets are committed.
+func (d *Deduplicator) Commit(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.pending) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(d.pending))
+	for id := range d.pending {
+		ids = append(ids, id)
+	}
+
+	err := d.store.Mark(ctx, ids...)
+	if err != nil {
+		return errors.Join(errors.New("error marking records as processed"), err)
+	}
+	clear(d.pending)
+
+	return nil
+}
+
+// Discard forgets the records handled since the last commit or discard, which will be
+// handled again
+func (d *Deduplicator) Discard() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	clear(d.pending)
+}
+
+// Close closes the store
+func (d *Deduplicator) Close() error {
+	return d.store.Close()
+}
+
+// FromConfig returns the deduplicator set by the dedup config, or nil if deduplication is disabled
+func FromConfig(cp config.ConfigProvider, log *slog.Logger) (*Deduplicator, error) {
+	conf := cp.GetDedup()
+
+	var extract Extractor
+	switch conf.Extractor {
+	case "":
+		return nil, nil
+	case config.DedupKey:
+		extract = KeyExtractor()
+	case config.DedupHeader:
+		extract = HeaderExtractor(conf.Field)
+	case config.DedupJSON:
+		extract = JSONFieldExtractor(conf.Field)
+	default:
+		return nil, fmt.Errorf("unknown dedup extractor %q", conf.Extractor)
+	}
+
+	var store Store
+	switch conf.Store {
+	case config.DedupMemory:
+		store = NewMemoryStore(conf.Size, conf.TTL)
+	case config.DedupDisk:
+		var err error
+		store, err = NewDiskStore(conf.Path, conf.TTL, log)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown dedup store %q", conf.Store)
+	}
+
+	return New(extract, store, log), nil
+}
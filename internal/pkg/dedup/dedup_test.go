@@ -0,0 +1,268 @@
+package dedup_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/dedup"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/handler"
+)
+
+func TestExtractors(t *testing.T) {
+	record := &kgo.Record{
+		Key:     []byte("customer-1"),
+		Value:   []byte(`{"metadata": {"eventId": "evt-42", "sequence": 1234567890123, "tags": ["a"]}}`),
+		Headers: []kgo.RecordHeader{{Key: "message-id", Value: []byte("msg-1")}},
+	}
+
+	tests := []struct {
+		name      string
+		extractor dedup.Extractor
+		record    *kgo.Record
+		want      string
+		wantErr   bool
+	}{
+		{name: "key", extractor: dedup.KeyExtractor(), record: record, want: "customer-1"},
+		{name: "header", extractor: dedup.HeaderExtractor("message-id"), record: record, want: "msg-1"},
+		{name: "missing header", extractor: dedup.HeaderExtractor("Message-Id"), record: record, want: ""},
+		{name: "json string", extractor: dedup.JSONFieldExtractor("metadata.eventId"), record: record, want: "evt-42"},
+		{name: "json number", extractor: dedup.JSONFieldExtractor("metadata.sequence"), record: record, want: "1234567890123"},
+		{name: "json array", extractor: dedup.JSONFieldExtractor("metadata.tags"), record: record, want: `["a"]`},
+		{name: "missing json field", extractor: dedup.JSONFieldExtractor("metadata.eventId.id"), record: record, want: ""},
+		{name: "invalid json", extractor: dedup.JSONFieldExtractor("id"), record: &kgo.Record{Value: []byte("id=1")}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := tt.extractor(tt.record)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %t but got: %v", tt.wantErr, err)
+			}
+			if id != tt.want {
+				t.Fatalf("expected ID %q but got %q", tt.want, id)
+			}
+		})
+	}
+}
+
+func TestStores(t *testing.T) {
+	ctx := context.Background()
+	ttl := 50 * time.Millisecond
+
+	diskStore, err := dedup.NewDiskStore(filepath.Join(t.TempDir(), "dedup.db"), ttl, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("unexpected error opening the disk store: %v", err)
+	}
+
+	stores := map[string]dedup.Store{
+		"memory": dedup.NewMemoryStore(10, ttl),
+		"disk":   diskStore,
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			defer store.Close()
+
+			err := store.Mark(ctx, "topic/1", "topic/2")
+			if err != nil {
+				t.Fatalf("unexpected mark error: %v", err)
+			}
+
+			for id, want := range map[string]bool{"topic/1": true, "topic/2": true, "topic/3": false} {
+				seen, err := store.Seen(ctx, id)
+				if err != nil || seen != want {
+					t.Fatalf("expected %s seen %t but got %t, %v", id, want, seen, err)
+				}
+			}
+
+			time.Sleep(2 * ttl)
+			seen, err := store.Seen(ctx, "topic/1")
+			if err != nil || seen {
+				t.Fatalf("expected the expired ID to be unseen but got %t, %v", seen, err)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreEviction(t *testing.T) {
+	ctx := context.Background()
+	store := dedup.NewMemoryStore(2, time.Hour)
+
+	_ = store.Mark(ctx, "1", "2")
+	// 1 is now the most recently seen ID, so 2 is evicted by 3
+	_, _ = store.Seen(ctx, "1")
+	_ = store.Mark(ctx, "3")
+
+	for id, want := range map[string]bool{"1": true, "2": false, "3": true} {
+		if seen, _ := store.Seen(ctx, id); seen != want {
+			t.Fatalf("expected %s seen %t but got %t", id, want, seen)
+		}
+	}
+}
+
+func TestDiskStorePersistence(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "dedup.db")
+	log := slog.New(slog.DiscardHandler)
+
+	store, err := dedup.NewDiskStore(path, time.Hour, log)
+	if err != nil {
+		t.Fatalf("unexpected error opening the disk store: %v", err)
+	}
+	_ = store.Mark(ctx, "topic/1")
+	_ = store.Close()
+
+	store, err = dedup.NewDiskStore(path, time.Hour, log)
+	if err != nil {
+		t.Fatalf("unexpected error reopening the disk store: %v", err)
+	}
+	defer store.Close()
+
+	seen, err := store.Seen(ctx, "topic/1")
+	if err != nil || !seen {
+		t.Fatalf("expected the ID to be kept across restarts but got %t, %v", seen, err)
+	}
+
+	pruned, err := store.Prune()
+	if err != nil || pruned != 0 {
+		t.Fatalf("expected nothing to prune but got %d, %v", pruned, err)
+	}
+}
+
+func TestDeduplicator(t *testing.T) {
+	ctx := context.Background()
+	dd := dedup.New(dedup.KeyExtractor(), dedup.NewMemoryStore(10, time.Hour), slog.New(slog.DiscardHandler))
+
+	var handled []string
+	h := dd.Wrap(handler.Func(func(_ context.Context, r *kgo.Record) error {
+		handled = append(handled, string(r.Value))
+		return nil
+	}))
+
+	handle := func(topic, key, value string) {
+		t.Helper()
+		err := h.Handle(ctx, &kgo.Record{Topic: topic, Key: []byte(key), Value: []byte(value)})
+		if err != nil {
+			t.Fatalf("unexpected handler error: %v", err)
+		}
+	}
+
+	handle("orders", "1", "first")
+	handle("orders", "1", "duplicate in the same batch")
+	handle("payments", "1", "same key in another topic")
+	handle("orders", "", "no ID")
+	handle("orders", "", "no ID again")
+	dd.Discard()
+
+	// the discarded records are handled again
+	handle("orders", "1", "retried")
+	if err := dd.Commit(ctx); err != nil {
+		t.Fatalf("unexpected commit error: %v", err)
+	}
+	handle("orders", "1", "duplicate after a rebalance")
+
+	want := []string{"first", "same key in another topic", "no ID", "no ID again", "retried"}
+	if len(handled) != len(want) {
+		t.Fatalf("expected %v to be handled but got %v", want, handled)
+	}
+	for i := range want {
+		if handled[i] != want[i] {
+			t.Fatalf("expected %v to be handled but got %v", want, handled)
+		}
+	}
+}
+
+func TestDeduplicatorBatch(t *testing.T) {
+	ctx := context.Background()
+	dd := dedup.New(dedup.KeyExtractor(), dedup.NewMemoryStore(10, time.Hour), slog.New(slog.DiscardHandler))
+
+	var handled []string
+	bh := dd.WrapBatch(handler.BatchFunc(func(_ context.Context, records []*kgo.Record) error {
+		batchErr := &handler.BatchError{}
+		for _, r := range records {
+			handled = append(handled, string(r.Key))
+			if string(r.Value) == "bad" {
+				batchErr.Fail(r, errors.New("invalid record"))
+			}
+		}
+		return batchErr.Err()
+	}))
+
+	batch := func(keys ...string) []*kgo.Record {
+		records := make([]*kgo.Record, 0, len(keys))
+		for _, key := range keys {
+			value := "ok"
+			if key == "3" {
+				value = "bad"
+			}
+			records = append(records, &kgo.Record{Topic: "orders", Key: []byte(key), Value: []byte(value)})
+		}
+		return records
+	}
+
+	_ = bh.HandleBatch(ctx, batch("1", "1", "2", "3"))
+	if err := dd.Commit(ctx); err != nil {
+		t.Fatalf("unexpected commit error: %v", err)
+	}
+	// 1 and 2 were processed, the failed 3 wasn't
+	_ = bh.HandleBatch(ctx, batch("1", "2", "3", "4"))
+
+	want := []string{"1", "2", "3", "3", "4"}
+	if len(handled) != len(want) {
+		t.Fatalf("expected %v to be handled but got %v", want, handled)
+	}
+	for i := range want {
+		if handled[i] != want[i] {
+			t.Fatalf("expected %v to be handled but got %v", want, handled)
+		}
+	}
+}
+
+// failingStore fails to check the IDs in fail
+type failingStore struct {
+	dedup.Store
+	fail map[string]bool
+}
+
+func (s failingStore) Seen(ctx context.Context, id string) (bool, error) {
+	if s.fail[id] {
+		return false, errors.New("store unavailable")
+	}
+	return s.Store.Seen(ctx, id)
+}
+
+func TestDeduplicatorBatchStoreError(t *testing.T) {
+	ctx := context.Background()
+	store := failingStore{Store: dedup.NewMemoryStore(10, time.Hour), fail: map[string]bool{"orders/2": true}}
+	_ = store.Mark(ctx, "orders/1")
+	dd := dedup.New(dedup.KeyExtractor(), store, slog.New(slog.DiscardHandler))
+
+	var handled []string
+	bh := dd.WrapBatch(handler.BatchFunc(func(_ context.Context, records []*kgo.Record) error {
+		for _, r := range records {
+			handled = append(handled, string(r.Key))
+		}
+		return nil
+	}))
+
+	records := make([]*kgo.Record, 0, 4)
+	for i, key := range []string{"1", "2", "3", "2"} {
+		records = append(records, &kgo.Record{Topic: "orders", Offset: int64(i), Key: []byte(key)})
+	}
+	err := bh.HandleBatch(ctx, records)
+
+	// only the record that couldn't be checked fails, not the duplicates
+	failures := handler.Failures(records, err)
+	if len(failures) != 1 || failures[0].Record != records[1] {
+		t.Fatalf("expected only the record at offset 1 to fail but got %v", err)
+	}
+	if len(handled) != 1 || handled[0] != "3" {
+		t.Fatalf("expected [3] to be handled but got %v", handled)
+	}
+}
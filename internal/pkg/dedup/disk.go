@@ -0,0 +1,140 @@
+package dedup
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var processedBucket = []byte("processed")
+
+// DiskStore keeps the IDs for their TTL in an embedded bbolt database file, so they survive
+// restarts. Expired IDs are removed in the background.
+type DiskStore struct {
+	db  *bolt.DB
+	ttl time.Duration
+	now func() time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewDiskStore opens, or creates, the store at path. The file is locked while the store is
+// open, so it can't be shared between consumers.
+func NewDiskStore(path string, ttl time.Duration, log *slog.Logger) (*DiskStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, errors.Join(errors.New("error opening the dedup store"), err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(processedBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.Join(errors.New("error creating the dedup store"), err)
+	}
+
+	s := &DiskStore{
+		db:   db,
+		ttl:  ttl,
+		now:  time.Now,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go s.pruneEvery(min(ttl, time.Hour), log)
+
+	return s, nil
+}
+
+func (s *DiskStore) Seen(_ context.Context, id string) (bool, error) {
+	seen := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		expires := tx.Bucket(processedBucket).Get([]byte(id))
+		seen = len(expires) == 8 && s.now().UnixNano() <= int64(binary.BigEndian.Uint64(expires))
+		return nil
+	})
+
+	return seen, err
+}
+
+func (s *DiskStore) Mark(_ context.Context, ids ...string) error {
+	expires := binary.BigEndian.AppendUint64(nil, uint64(s.now().Add(s.ttl).UnixNano()))
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(processedBucket)
+		for _, id := range ids {
+			if err := bucket.Put([]byte(id), expires); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Prune removes the expired IDs and returns how many were removed
+func (s *DiskStore) Prune() (int, error) {
+	now := s.now().UnixNano()
+	pruned := 0
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(processedBucket)
+
+		// deleting while iterating with a cursor skips keys
+		var expired [][]byte
+		err := bucket.ForEach(func(id, expires []byte) error {
+			if len(expires) != 8 || now > int64(binary.BigEndian.Uint64(expires)) {
+				expired = append(expired, id)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, id := range expired {
+			if err := bucket.Delete(id); err != nil {
+				return err
+			}
+		}
+		pruned = len(expired)
+		return nil
+	})
+
+	return pruned, err
+}
+
+func (s *DiskStore) pruneEvery(interval time.Duration, log *slog.Logger) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		pruned, err := s.Prune()
+		if err != nil {
+			log.Error("error pruning the dedup store", "error", err.Error())
+			continue
+		}
+		log.Debug("dedup store pruned", "pruned", pruned)
+	}
+}
+
+// Close stops pruning and closes the database
+func (s *DiskStore) Close() error {
+	close(s.stop)
+	<-s.done
+
+	return s.db.Close()
+}
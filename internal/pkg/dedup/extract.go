@@ -0,0 +1,74 @@
+package dedup
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Extractor returns the ID of a record, or an empty ID for records that can't be identified,
+// which are never deduplicated
+type Extractor func(r *kgo.Record) (string, error)
+
+// KeyExtractor identifies records by their key
+func KeyExtractor() Extractor {
+	return func(r *kgo.Record) (string, error) {
+		return string(r.Key), nil
+	}
+}
+
+// HeaderExtractor identifies records by the value of their name header. Header names are case
+// sensitive, and the last header is used when a record has several.
+func HeaderExtractor(name string) Extractor {
+	return func(r *kgo.Record) (string, error) {
+		var id string
+		for _, header := range r.Headers {
+			if header.Key == name {
+				id = string(header.Value)
+			}
+		}
+		return id, nil
+	}
+}
+
+// JSONFieldExtractor identifies records by a field of their JSON value, found by its dot
+// separated path e.g. "metadata.eventId". Strings are used as is, and other values as their JSON.
+func JSONFieldExtractor(path string) Extractor {
+	keys := strings.Split(path, ".")
+
+	return func(r *kgo.Record) (string, error) {
+		var value any
+		decoder := json.NewDecoder(bytes.NewReader(r.Value))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return "", fmt.Errorf("error decoding the record value: %w", err)
+		}
+
+		for _, key := range keys {
+			object, ok := value.(map[string]any)
+			if !ok {
+				return "", nil
+			}
+			value = object[key]
+		}
+
+		switch v := value.(type) {
+		case nil:
+			return "", nil
+		case string:
+			return v, nil
+		case json.Number:
+			return v.String(), nil
+		default:
+			id, err := json.Marshal(v)
+			if err != nil {
+				return "", errors.Join(fmt.Errorf("error encoding the %s field", path), err)
+			}
+			return string(id), nil
+		}
+	}
+}
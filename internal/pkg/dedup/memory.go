@@ -0,0 +1,83 @@
+package dedup
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the IDs in memory for their TTL, evicting the least recently seen IDs once
+// full. IDs are lost when the consumer restarts.
+type MemoryStore struct {
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu    sync.Mutex
+	ids   map[string]*list.Element
+	order *list.List
+}
+
+type memoryEntry struct {
+	id      string
+	expires time.Time
+}
+
+// NewMemoryStore returns a store of up to size IDs kept for ttl
+func NewMemoryStore(size int, ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		size:  size,
+		ttl:   ttl,
+		now:   time.Now,
+		ids:   make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+func (s *MemoryStore) Seen(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.ids[id]
+	if !ok {
+		return false, nil
+	}
+	if s.now().After(elem.Value.(*memoryEntry).expires) {
+		s.remove(elem)
+		return false, nil
+	}
+
+	s.order.MoveToFront(elem)
+	return true, nil
+}
+
+func (s *MemoryStore) Mark(_ context.Context, ids ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expires := s.now().Add(s.ttl)
+	for _, id := range ids {
+		if elem, ok := s.ids[id]; ok {
+			elem.Value.(*memoryEntry).expires = expires
+			s.order.MoveToFront(elem)
+			continue
+		}
+
+		s.ids[id] = s.order.PushFront(&memoryEntry{id: id, expires: expires})
+		for s.order.Len() > s.size {
+			s.remove(s.order.Back())
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+func (s *MemoryStore) remove(elem *list.Element) {
+	s.order.Remove(elem)
+	delete(s.ids, elem.Value.(*memoryEntry).id)
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// BatchHandler processes the consumed records in batches. Every batch holds records of a single
+// partition, in offset order.
+//
+// Returning a *BatchError fails the records it lists, and any other error fails the whole batch.
+// Failed records are logged and sent to the dead letter topic, if any, before the offsets of
+// the batch are committed. In the transactional mode, without a dead letter topic, failures
+// abort the transaction instead.
+type BatchHandler interface {
+	HandleBatch(ctx context.Context, records []*kgo.Record) error
+}
+
+// BatchFunc adapts a func to a BatchHandler
+type BatchFunc func(ctx context.Context, records []*kgo.Record) error
+
+func (f BatchFunc) HandleBatch(ctx context.Context, records []*kgo.Record) error {
+	return f(ctx, records)
+}
+
+// Failure is a record that failed, and why
+type Failure struct {
+	Record *kgo.Record
+	Err    error
+}
+
+// BatchError reports the records of a batch that failed. The other records of the batch succeeded.
+type BatchError struct {
+	Failures []Failure
+}
+
+// Fail adds r to the failed records
+func (e *BatchError) Fail(r *kgo.Record, err error) {
+	e.Failures = append(e.Failures, Failure{Record: r, Err: err})
+}
+
+// Err returns e if records failed, and nil otherwise
+func (e *BatchError) Err() error {
+	if len(e.Failures) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *BatchError) Error() string {
+	errs := make([]error, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		errs = append(errs, fmt.Errorf("%s/%d at offset %d: %w", f.Record.Topic, f.Record.Partition, f.Record.Offset, f.Err))
+	}
+
+	return fmt.Sprintf("%d records failed: %v", len(e.Failures), errors.Join(errs...))
+}
+
+// Failures returns the records of records that failed according to err, the error returned by
+// handling them as a batch
+func Failures(records []*kgo.Record, err error) []Failure {
+	if err == nil {
+		return nil
+	}
+
+	var batchErr *BatchError
+	if errors.As(err, &batchErr) {
+		return batchErr.Failures
+	}
+
+	failures := make([]Failure, 0, len(records))
+	for _, r := range records {
+		failures = append(failures, Failure{Record: r, Err: err})
+	}
+	return failures
+}
+
+// PerRecord adapts a per-record handler to a BatchHandler, handling the records of a batch one
+// by one and reporting the ones that failed
+func PerRecord(h Handler) BatchHandler {
+	return BatchFunc(func(ctx context.Context, records []*kgo.Record) error {
+		batchErr := &BatchError{}
+		for _, r := range records {
+			if err := h.Handle(ctx, r); err != nil {
+				batchErr.Fail(r, err)
+			}
+		}
+		return batchErr.Err()
+	})
+}
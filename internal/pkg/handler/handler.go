@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"context"
+	"errors"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+var ErrNoEmitter = errors.New("no emitter in context")
+
+// Handler processes the consumed records. Returning an error fails the record, which is then
+// handled according to the consumer mode e.g. the transaction is aborted and the records are
+// processed again in the transactional mode.
+type Handler interface {
+	Handle(ctx context.Context, r *kgo.Record) error
+}
+
+// Func adapts a func to a Handler
+type Func func(ctx context.Context, r *kgo.Record) error
+
+func (f Func) Handle(ctx context.Context, r *kgo.Record) error {
+	return f(ctx, r)
+}
+
+// Emitter produces the records output by handlers. Emit produces asynchronously: the consumer
+// waits for the emitted records to be produced before committing the offsets of the records
+// handled. A record that couldn't be produced isn't tied back to the record that emitted it, so
+// it stops the consumer without committing, and the records are handled again on restart.
+// Handlers needing to react to a failed emit use EmitSync. Records without a topic go to the
+// output topic of the config, and keyed records are partitioned by their key.
+type Emitter interface {
+	Emit(ctx context.Context, r *kgo.Record) error
+}
+
+// SyncEmitter is implemented by the emitters able to wait for a record to be produced
+type SyncEmitter interface {
+	EmitSync(ctx context.Context, r *kgo.Record) error
+}
+
+type emitterKey struct{}
+
+// WithEmitter returns a copy of ctx handing emitter to the handlers it's passed to
+func WithEmitter(ctx context.Context, emitter Emitter) context.Context {
+	return context.WithValue(ctx, emitterKey{}, emitter)
+}
+
+// EmitterFrom returns the emitter of ctx, if any
+func EmitterFrom(ctx context.Context) (Emitter, bool) {
+	emitter, ok := ctx.Value(emitterKey{}).(Emitter)
+	return emitter, ok
+}
+
+// Emit produces r with the emitter of ctx. In the transactional mode, r is part of the
+// transaction committing the offsets of the record being handled.
+func Emit(ctx context.Context, r *kgo.Record) error {
+	emitter, ok := EmitterFrom(ctx)
+	if !ok {
+		return ErrNoEmitter
+	}
+
+	return emitter.Emit(ctx, r)
+}
+
+// EmitSync produces r with the emitter of ctx and waits for it to be produced, for handlers that
+// depend on the produce result e.g. to read the offset set on r
+func EmitSync(ctx context.Context, r *kgo.Record) error {
+	emitter, ok := EmitterFrom(ctx)
+	if !ok {
+		return ErrNoEmitter
+	}
+
+	syncEmitter, ok := emitter.(SyncEmitter)
+	if !ok {
+		return errors.New("the emitter can't produce synchronously")
+	}
+
+	return syncEmitter.EmitSync(ctx, r)
+}
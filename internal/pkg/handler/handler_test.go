@@ -0,0 +1,115 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/handler"
+)
+
+type testEmitter struct {
+	records []*kgo.Record
+}
+
+func (e *testEmitter) Emit(_ context.Context, r *kgo.Record) error {
+	e.records = append(e.records, r)
+	return nil
+}
+
+func TestEmit(t *testing.T) {
+	r := &kgo.Record{Topic: "data-set-out", Value: []byte("transformed")}
+
+	err := handler.Emit(context.Background(), r)
+	if !errors.Is(err, handler.ErrNoEmitter) {
+		t.Fatalf("expected ErrNoEmitter without an emitter but got: %v", err)
+	}
+
+	emitter := &testEmitter{}
+	h := handler.Func(func(ctx context.Context, r *kgo.Record) error {
+		return handler.Emit(ctx, r)
+	})
+
+	err = h.Handle(handler.WithEmitter(context.Background(), emitter), r)
+	if err != nil {
+		t.Fatalf("unexpected emit error: %v", err)
+	}
+	if len(emitter.records) != 1 || emitter.records[0] != r {
+		t.Fatalf("expected the record to be emitted but got: %v", emitter.records)
+	}
+}
+
+func TestEmitSync(t *testing.T) {
+	r := &kgo.Record{Key: []byte("customer-1"), Value: []byte("transformed")}
+
+	err := handler.EmitSync(handler.WithEmitter(context.Background(), &testEmitter{}), r)
+	if err == nil {
+		t.Fatal("expected an error from an emitter that can't produce synchronously")
+	}
+
+	emitter := &testSyncEmitter{}
+	err = handler.EmitSync(handler.WithEmitter(context.Background(), emitter), r)
+	if err != nil {
+		t.Fatalf("unexpected emit error: %v", err)
+	}
+	if len(emitter.synced) != 1 || emitter.synced[0] != r {
+		t.Fatalf("expected the record to be emitted synchronously but got: %v", emitter.synced)
+	}
+}
+
+type testSyncEmitter struct {
+	testEmitter
+	synced []*kgo.Record
+}
+
+func (e *testSyncEmitter) EmitSync(_ context.Context, r *kgo.Record) error {
+	e.synced = append(e.synced, r)
+	return nil
+}
+
+func TestPerRecord(t *testing.T) {
+	errInvalid := errors.New("invalid record")
+	records := []*kgo.Record{{Offset: 1, Value: []byte("ok")}, {Offset: 2, Value: []byte("bad")}, {Offset: 3, Value: []byte("ok")}}
+
+	bh := handler.PerRecord(handler.Func(func(_ context.Context, r *kgo.Record) error {
+		if string(r.Value) == "bad" {
+			return errInvalid
+		}
+		return nil
+	}))
+
+	err := bh.HandleBatch(context.Background(), records)
+	failures := handler.Failures(records, err)
+	if len(failures) != 1 || failures[0].Record.Offset != 2 || !errors.Is(failures[0].Err, errInvalid) {
+		t.Fatalf("expected offset 2 to fail but got: %v", err)
+	}
+
+	err = bh.HandleBatch(context.Background(), records[:1])
+	if err != nil {
+		t.Fatalf("unexpected batch error: %v", err)
+	}
+}
+
+func TestFailures(t *testing.T) {
+	records := []*kgo.Record{{Offset: 1}, {Offset: 2}}
+
+	if failures := handler.Failures(records, nil); len(failures) != 0 {
+		t.Fatalf("expected no failures but got %v", failures)
+	}
+
+	// errors other than BatchError fail the whole batch
+	failures := handler.Failures(records, errors.New("sink unavailable"))
+	if len(failures) != 2 {
+		t.Fatalf("expected every record to fail but got %v", failures)
+	}
+
+	batchErr := &handler.BatchError{}
+	batchErr.Fail(records[1], errors.New("invalid record"))
+	failures = handler.Failures(records, fmt.Errorf("wrapped: %w", batchErr.Err()))
+	if len(failures) != 1 || failures[0].Record != records[1] {
+		t.Fatalf("expected offset 2 to fail but got %v", failures)
+	}
+}
@@ -3,10 +3,12 @@ package healthcheck
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"sync"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/health"
 	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
 
@@ -15,16 +17,25 @@ import (
 )
 
 var (
-	healthServer     *health.Server
-	grpcServer       *grpc.Server
-	serverOnce       sync.Once
-	livenessSvcName  string
-	readinessSvcName string
+	healthServer        *health.Server
+	grpcServer          *grpc.Server
+	serverOnce          sync.Once
+	livenessSvcName     string
+	readinessSvcName    string
+	certificatesSvcName string
 )
 
+// Health checks, served as the "<HEALTHCHECK_SERVICE_PREFIX>-<check>" services
 const (
-	livenessSuffix  = "-liveness"
-	readinessSuffix = "-readiness"
+	LivenessCheck     = "liveness"
+	ReadinessCheck    = "readiness"
+	CertificatesCheck = "certificates"
+)
+
+const (
+	livenessSuffix     = "-" + LivenessCheck
+	readinessSuffix    = "-" + ReadinessCheck
+	certificatesSuffix = "-" + CertificatesCheck
 )
 
 func Start(cp config.ConfigProvider) error {
@@ -32,7 +43,7 @@ func Start(cp config.ConfigProvider) error {
 	var err error
 
 	serverOnce.Do(func() {
-		healthcheckAddress := ":" + cp.GetHealthcheckPort()
+		healthcheckAddress := fmt.Sprintf(":%d", cp.GetHealthcheckPort())
 		var listener net.Listener
 		listener, err = net.Listen("tcp", healthcheckAddress)
 		if err != nil {
@@ -43,6 +54,7 @@ func Start(cp config.ConfigProvider) error {
 		servicePrefix := cp.GetHealthcheckServicePrefix()
 		livenessSvcName = servicePrefix + livenessSuffix
 		readinessSvcName = servicePrefix + readinessSuffix
+		certificatesSvcName = servicePrefix + certificatesSuffix
 		grpcServer = grpc.NewServer([]grpc.ServerOption{}...)
 		healthServer = health.NewServer()
 		healthgrpc.RegisterHealthServer(grpcServer, healthServer)
@@ -78,6 +90,12 @@ func SetAppReadinessStatus(status healthgrpc.HealthCheckResponse_ServingStatus)
 	healthServer.SetServingStatus(readinessSvcName, status)
 }
 
+// SetCertificatesStatus sets the status of the service reporting whether the app's certificates are valid.
+// It's NOT_SERVING once any of them has expired.
+func SetCertificatesStatus(status healthgrpc.HealthCheckResponse_ServingStatus) {
+	healthServer.SetServingStatus(certificatesSvcName, status)
+}
+
 // SetServiceStatus sets the health status for service
 func SetServiceStatus(service string, status healthgrpc.HealthCheckResponse_ServingStatus) {
 	healthServer.SetServingStatus(service, status)
@@ -100,3 +118,29 @@ func GetAppLivenessStatus(ctx context.Context) (*healthgrpc.HealthCheckResponse,
 func GetAppReadinessStatus(ctx context.Context) (*healthgrpc.HealthCheckResponse, error) {
 	return GetServiceStatus(ctx, readinessSvcName)
 }
+
+// GetCertificatesStatus returns the status of the app's certificates
+func GetCertificatesStatus(ctx context.Context) (*healthgrpc.HealthCheckResponse, error) {
+	return GetServiceStatus(ctx, certificatesSvcName)
+}
+
+// ServiceName returns the name of the service serving check
+func ServiceName(cp config.ConfigProvider, check string) string {
+	return cp.GetHealthcheckServicePrefix() + "-" + check
+}
+
+// Check asks the health server at address for the status of service, like a gRPC probe does
+func Check(ctx context.Context, address, service string) (healthgrpc.HealthCheckResponse_ServingStatus, error) {
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return healthgrpc.HealthCheckResponse_UNKNOWN, err
+	}
+	defer conn.Close()
+
+	resp, err := healthgrpc.NewHealthClient(conn).Check(ctx, &healthgrpc.HealthCheckRequest{Service: service})
+	if err != nil {
+		return healthgrpc.HealthCheckResponse_UNKNOWN, err
+	}
+
+	return resp.GetStatus(), nil
+}
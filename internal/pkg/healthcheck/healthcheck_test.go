@@ -2,6 +2,7 @@ package healthcheck_test
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
@@ -26,7 +27,7 @@ func initHealthClient(cp config.ConfigProvider) (healthgrpc.HealthClient, closeC
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 	}
 
-	conn, err := grpc.NewClient("localhost:"+port, opts...)
+	conn, err := grpc.NewClient(fmt.Sprintf("localhost:%d", port), opts...)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -70,6 +71,35 @@ func testClientStatusCheck(t *testing.T) {
 	failUnnexpectedStatus(t, healthgrpc.HealthCheckResponse_SERVING, resp.GetStatus())
 }
 
+// testCheck tests checking the health of a service the way the healthcheck command does
+func testCheck(t *testing.T) {
+	t.Parallel()
+
+	appConfig, err := config.InitAppConfig()
+	if err != nil {
+		t.Fatalf("failed to init env provider: %v", err)
+	}
+
+	if got, want := healthcheck.ServiceName(appConfig, healthcheck.LivenessCheck), appConfig.GetHealthcheckServicePrefix()+"-liveness"; got != want {
+		t.Fatalf("expected service name %s but got %s", want, got)
+	}
+
+	newService := "new-checked-service"
+	healthcheck.SetServiceStatus(newService, healthgrpc.HealthCheckResponse_NOT_SERVING)
+
+	address := fmt.Sprintf("localhost:%d", appConfig.GetHealthcheckPort())
+	status, err := healthcheck.Check(context.Background(), address, newService)
+	if err != nil {
+		t.Fatalf("failed to check the health of service %s: %v", newService, err)
+	}
+	failUnnexpectedStatus(t, healthgrpc.HealthCheckResponse_NOT_SERVING, status)
+
+	_, err = healthcheck.Check(context.Background(), address, "unknown-service")
+	if err == nil {
+		t.Fatalf("expected an error checking an unknown service")
+	}
+}
+
 // testInternalAppStatus tests internal wrapper funcs for setting and getting the
 // health status of this app and its services
 func testInternalAppStatus(t *testing.T) {
@@ -171,6 +201,10 @@ func TestHealthcheck(t *testing.T) {
 			name:     "Test Client Status Check",
 			testFunc: testClientStatusCheck,
 		},
+		{
+			name:     "Test Check",
+			testFunc: testCheck,
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,119 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+)
+
+var ErrNoSeedBrokers = errors.New("no seed brokers configured or discovered")
+
+// Resolver looks up the DNS records used to discover seed brokers. *net.Resolver implements it.
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// SeedBrokers returns the configured seed brokers followed by the ones discovered through DNS
+// (see config.KafkaOptions). Failed lookups are logged and skipped, so discovery only fails
+// when no seed broker is left.
+func SeedBrokers(ctx context.Context, cp config.ConfigProvider, resolver Resolver, log *slog.Logger) ([]string, error) {
+	options := cp.GetMessageQueueOptions()
+	seeds := slices.Clone(cp.GetMessageQueueURLs())
+
+	for _, record := range options.SeedSRVRecords {
+		_, addrs, err := resolver.LookupSRV(ctx, "", "", record)
+		if err != nil {
+			log.Warn("error looking up seed broker SRV record", "record", record, "error", err.Error())
+			continue
+		}
+		for _, addr := range addrs {
+			host := strings.TrimSuffix(addr.Target, ".")
+			seeds = append(seeds, net.JoinHostPort(host, strconv.Itoa(int(addr.Port))))
+		}
+	}
+
+	if options.ResolveSeeds {
+		var resolved []string
+		for _, seed := range seeds {
+			host, port, err := net.SplitHostPort(seed)
+			if err != nil || net.ParseIP(host) != nil {
+				resolved = append(resolved, seed)
+				continue
+			}
+
+			addrs, err := resolver.LookupHost(ctx, host)
+			if err != nil {
+				log.Warn("error resolving seed broker", "broker", seed, "error", err.Error())
+				resolved = append(resolved, seed)
+				continue
+			}
+			for _, addr := range addrs {
+				resolved = append(resolved, net.JoinHostPort(addr, port))
+			}
+		}
+		seeds = resolved
+	}
+
+	seeds = dedupe(seeds)
+	if len(seeds) == 0 {
+		return nil, ErrNoSeedBrokers
+	}
+
+	return seeds, nil
+}
+
+// dedupe removes the repeated values of s, keeping the first occurrences in order
+func dedupe(s []string) []string {
+	seen := map[string]bool{}
+	var deduped []string
+	for _, val := range s {
+		if !seen[val] {
+			seen[val] = true
+			deduped = append(deduped, val)
+		}
+	}
+
+	return deduped
+}
+
+// LogBrokerMetadata logs the cluster and brokers the client is connected to
+func LogBrokerMetadata(ctx context.Context, client *kgo.Client, log *slog.Logger) error {
+	req := kmsg.NewPtrMetadataRequest()
+	// no topics, only the brokers are needed
+	req.Topics = []kmsg.MetadataRequestTopic{}
+
+	resp, err := req.RequestWith(ctx, client)
+	if err != nil {
+		return errors.Join(errors.New("failed to get broker metadata"), err)
+	}
+
+	clusterID := ""
+	if resp.ClusterID != nil {
+		clusterID = *resp.ClusterID
+	}
+	log.Info("connected to kafka cluster", "clusterID", clusterID, "controllerID", resp.ControllerID, "brokers", len(resp.Brokers))
+
+	for _, broker := range resp.Brokers {
+		rack := ""
+		if broker.Rack != nil {
+			rack = *broker.Rack
+		}
+		log.Info("kafka broker discovered",
+			"nodeID", broker.NodeID,
+			"address", net.JoinHostPort(broker.Host, strconv.Itoa(int(broker.Port))),
+			"rack", rack,
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/kafka"
+)
+
+// testConfig overrides the message queue getters of the embedded provider, which is left nil
+type testConfig struct {
+	config.ConfigProvider
+	urls    []string
+	options config.KafkaOptions
+}
+
+func (tc testConfig) GetMessageQueueURLs() []string {
+	return tc.urls
+}
+
+func (tc testConfig) GetMessageQueueOptions() config.KafkaOptions {
+	return tc.options
+}
+
+type testResolver struct {
+	srv   map[string][]*net.SRV
+	hosts map[string][]string
+}
+
+func (tr testResolver) LookupSRV(_ context.Context, _, _, name string) (string, []*net.SRV, error) {
+	addrs, ok := tr.srv[name]
+	if !ok {
+		return "", nil, errors.New("no such host")
+	}
+	return name, addrs, nil
+}
+
+func (tr testResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	addrs, ok := tr.hosts[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return addrs, nil
+}
+
+func TestSeedBrokers(t *testing.T) {
+	resolver := testResolver{
+		srv: map[string][]*net.SRV{
+			"_tcp-clients._tcp.kafka-brokers.kafka.svc": {
+				{Target: "kafka-0.kafka-brokers.kafka.svc.", Port: 9093},
+				{Target: "kafka-1.kafka-brokers.kafka.svc.", Port: 9093},
+			},
+		},
+		hosts: map[string][]string{
+			"kafka-bootstrap": {"10.0.0.1", "10.0.0.2"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		urls    []string
+		options config.KafkaOptions
+		seeds   []string
+		err     error
+	}{
+		{
+			name:  "configured brokers",
+			urls:  []string{"kafka-0:9093", "kafka-1:9093", "kafka-0:9093"},
+			seeds: []string{"kafka-0:9093", "kafka-1:9093"},
+		},
+		{
+			name:    "SRV records",
+			urls:    []string{"kafka-bootstrap:9093"},
+			options: config.KafkaOptions{SeedSRVRecords: []string{"_tcp-clients._tcp.kafka-brokers.kafka.svc", "_missing._tcp.kafka"}},
+			seeds:   []string{"kafka-bootstrap:9093", "kafka-0.kafka-brokers.kafka.svc:9093", "kafka-1.kafka-brokers.kafka.svc:9093"},
+		},
+		{
+			name:    "resolved seeds",
+			urls:    []string{"kafka-bootstrap:9093", "10.0.0.2:9093", "unresolvable:9093"},
+			options: config.KafkaOptions{ResolveSeeds: true},
+			seeds:   []string{"10.0.0.1:9093", "10.0.0.2:9093", "unresolvable:9093"},
+		},
+		{
+			name:    "nothing discovered",
+			options: config.KafkaOptions{SeedSRVRecords: []string{"_missing._tcp.kafka"}},
+			err:     kafka.ErrNoSeedBrokers,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cp := testConfig{urls: tt.urls, options: tt.options}
+			seeds, err := kafka.SeedBrokers(context.Background(), cp, resolver, slog.New(slog.DiscardHandler))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v but got %v", tt.err, err)
+			}
+			if !slices.Equal(seeds, tt.seeds) {
+				t.Fatalf("expected seeds %v but got %v", tt.seeds, seeds)
+			}
+		})
+	}
+}
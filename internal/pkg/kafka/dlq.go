@@ -0,0 +1,43 @@
+package kafka
+
+import (
+	"strconv"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Headers added to the records sent to the dead letter topic
+const (
+	DLQTopicHeader     = "dlq.topic"
+	DLQPartitionHeader = "dlq.partition"
+	DLQOffsetHeader    = "dlq.offset"
+	DLQErrorHeader     = "dlq.error"
+)
+
+// dlqHeaders are the headers added to the records sent to the dead letter topic
+var dlqHeaders = []string{DLQTopicHeader, DLQPartitionHeader, DLQOffsetHeader, DLQErrorHeader}
+
+// DeadLetter returns the record to send to the dead letter topic for r, which failed with err:
+// r with its key, value and headers, and headers telling where it was consumed from and why it
+// failed, so it can be inspected and replayed. The topic, partition and offset of records failing
+// after their retries are the ones they were first consumed at, before being retried.
+func DeadLetter(topic string, r *kgo.Record, err error) *kgo.Record {
+	partition, offset := OriginPosition(r)
+
+	headers := make([]kgo.RecordHeader, 0, len(r.Headers)+4)
+	headers = append(headers, r.Headers...)
+	headers = append(headers,
+		kgo.RecordHeader{Key: DLQTopicHeader, Value: []byte(OriginTopic(r))},
+		kgo.RecordHeader{Key: DLQPartitionHeader, Value: []byte(strconv.FormatInt(int64(partition), 10))},
+		kgo.RecordHeader{Key: DLQOffsetHeader, Value: []byte(strconv.FormatInt(offset, 10))},
+		kgo.RecordHeader{Key: DLQErrorHeader, Value: []byte(err.Error())},
+	)
+
+	return &kgo.Record{
+		Topic:     topic,
+		Key:       r.Key,
+		Value:     r.Value,
+		Headers:   headers,
+		Timestamp: r.Timestamp,
+	}
+}
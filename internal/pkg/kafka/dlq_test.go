@@ -0,0 +1,46 @@
+package kafka_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/kafka"
+)
+
+func TestDeadLetter(t *testing.T) {
+	r := &kgo.Record{
+		Topic:     "data-set-1",
+		Partition: 3,
+		Offset:    1500,
+		Key:       []byte("customer-1"),
+		Value:     []byte(`{"id": 1}`),
+		Headers:   []kgo.RecordHeader{{Key: "trace-id", Value: []byte("abc")}},
+	}
+
+	dl := kafka.DeadLetter("data-set-1-dlq", r, errors.New("invalid record"))
+
+	if dl.Topic != "data-set-1-dlq" || string(dl.Key) != "customer-1" || string(dl.Value) != `{"id": 1}` {
+		t.Fatalf("expected the record to be sent as is to the dead letter topic but got %+v", dl)
+	}
+
+	want := map[string]string{
+		"trace-id":               "abc",
+		kafka.DLQTopicHeader:     "data-set-1",
+		kafka.DLQPartitionHeader: "3",
+		kafka.DLQOffsetHeader:    "1500",
+		kafka.DLQErrorHeader:     "invalid record",
+	}
+	if len(dl.Headers) != len(want) {
+		t.Fatalf("expected headers %v but got %v", want, dl.Headers)
+	}
+	for _, header := range dl.Headers {
+		if want[header.Key] != string(header.Value) {
+			t.Fatalf("expected header %s to be %q but got %q", header.Key, want[header.Key], header.Value)
+		}
+	}
+	if len(r.Headers) != 1 {
+		t.Fatalf("expected the consumed record to be left unchanged but got headers %v", r.Headers)
+	}
+}
@@ -2,25 +2,377 @@ package kafka
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"slices"
+	"sync"
+	"time"
 
+	"github.com/twmb/franz-go/pkg/kadm"
 	"github.com/twmb/franz-go/pkg/kgo"
 
 	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/logger"
 	"github.com/rodney-b/swish-test-consumer/pkg/certs"
 )
 
-func NewClient(ctx context.Context, cp config.ConfigProvider) (*kgo.Client, error) {
-	tlsConfig, err := certs.CreateTLSConfig(cp.GetMessageQueueClientCA(), cp.GetMessageQueueClientCert(), cp.GetMessageQueueClientCertKey())
+// Option customizes the client created by NewClient
+type Option func(*clientOptions)
+
+type clientOptions struct {
+	tokenSource   TokenSource
+	assignments   map[string]config.Offset
+	assigned      bool
+	onRevoked     func(*kgo.Client, map[string][]int32)
+	readCommitted bool
+}
+
+// WithAssignments consumes the "<topic>/<partition>" keys of assignments from their offsets
+// without joining the group, overriding the assignments of the config (see config.KafkaOptions).
+// The client never joins the group with this option, even if assignments is empty.
+func WithAssignments(assignments map[string]config.Offset) Option {
+	return func(o *clientOptions) {
+		o.assignments = assignments
+		o.assigned = true
+	}
+}
+
+// WithTokenSource sets where the OAUTHBEARER tokens come from, instead of the token or token URL
+// of the message queue SASL config
+func WithTokenSource(tokenSource TokenSource) Option {
+	return func(o *clientOptions) {
+		o.tokenSource = tokenSource
+	}
+}
+
+// WithOnRevoked calls onRevoked with the partitions the group member stops consuming, whether
+// revoked by a rebalance or lost, before they're reassigned
+func WithOnRevoked(onRevoked func(client *kgo.Client, partitions map[string][]int32)) Option {
+	return func(o *clientOptions) {
+		o.onRevoked = onRevoked
+	}
+}
+
+// WithReadCommitted consumes with the read_committed isolation level whatever the configured level
+func WithReadCommitted() Option {
+	return func(o *clientOptions) {
+		o.readCommitted = true
+	}
+}
+
+// NewClient returns a client consuming the configured topics as part of the group, or the
+// assigned partitions without a group, over TLS and authenticated with the client certificate
+// and/or the SASL mechanism set in the config.
+//
+// Group offsets aren't committed automatically: the consumer commits the offsets of the records
+// it polled once they're handled and the records they emitted produced. Rebalances are blocked
+// while polled records are handled, until the client allows them again with AllowRebalance.
+func NewClient(ctx context.Context, cp config.ConfigProvider, options ...Option) (*kgo.Client, error) {
+	o := &clientOptions{}
+	for _, option := range options {
+		option(o)
+	}
+	assignments, direct := o.assignments, o.assigned
+	if !direct {
+		assignments = cp.GetMessageQueueOptions().Assignments
+		direct = len(assignments) > 0
+	}
+	if direct && len(assignments) == 0 {
+		return nil, errors.New("no partitions assigned")
+	}
+
+	var partitions map[string]map[int32]config.Offset
+	if direct {
+		var err error
+		partitions, err = config.Assignments(assignments)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	opts, release, err := connectionOpts(ctx, cp, options...)
 	if err != nil {
 		return nil, err
 	}
 
+	if direct {
+		opts = append(opts, kgo.ConsumePartitions(kgoPartitionOffsets(partitions)))
+	} else {
+		opts = append(opts,
+			kgo.ConsumeTopics(subscribedTopics(cp)...),
+			kgo.ConsumerGroup(cp.GetMessageQueueGroupID()),
+			kgo.DisableAutoCommit(),
+			kgo.BlockRebalanceOnPoll(),
+		)
+		if o.onRevoked != nil {
+			onRevoked := func(_ context.Context, client *kgo.Client, partitions map[string][]int32) {
+				o.onRevoked(client, partitions)
+			}
+			opts = append(opts, kgo.OnPartitionsRevoked(onRevoked), kgo.OnPartitionsLost(onRevoked))
+		}
+	}
+	opts = append(opts, consumerOpts(cp, direct)...)
+	if o.readCommitted {
+		opts = append(opts, kgo.FetchIsolationLevel(kgo.ReadCommitted()))
+	}
+
+	return newKgoClient(opts, release)
+}
+
+// NewAdminClient returns an admin client connected like the consumer but outside of its group.
+// The admin client must be closed once done with.
+func NewAdminClient(ctx context.Context, cp config.ConfigProvider, options ...Option) (*kadm.Client, error) {
+	opts, release, err := connectionOpts(ctx, cp, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newKgoClient(opts, release)
+	if err != nil {
+		return nil, err
+	}
+
+	return kadm.NewClient(client), nil
+}
+
+// newKgoClient returns a client created with opts, calling release if it can't be created
+func newKgoClient(opts []kgo.Opt, release func()) (*kgo.Client, error) {
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// onClose calls its function once the client is closed
+type onClose func()
+
+func (fn onClose) OnClientClosed(*kgo.Client) { fn() }
+
+// connectionOpts returns the kgo options used to connect to the cluster. The resources the options
+// hold, e.g. the certificate reloader, are released once the client is closed, or by calling
+// release if the client isn't created.
+func connectionOpts(ctx context.Context, cp config.ConfigProvider, options ...Option) (opts []kgo.Opt, release func(), err error) {
+	o := &clientOptions{}
+	for _, option := range options {
+		option(o)
+	}
+
+	var tlsConfig *tls.Config
+	release = func() {}
+	if cp.GetMessageQueueTLSEnabled() {
+		tlsConfig, release, err = newTLSConfig(cp)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	defer func() {
+		if err != nil {
+			release()
+		}
+	}()
+
+	mechanism, err := newSASLMechanism(cp, o.tokenSource)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seeds, err := SeedBrokers(ctx, cp, net.DefaultResolver, logger.New("kafka"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clientID := cp.GetMessageQueueOptions().ClientID
+	if clientID == "" {
+		clientID = cp.GetAppName()
+	}
+
+	opts = []kgo.Opt{
+		kgo.SeedBrokers(seeds...),
+		kgo.MetadataMaxAge(cp.GetMessageQueueOptions().MetadataMaxAge),
+		kgo.WithHooks(onClose(release)),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, kgo.DialTLSConfig(tlsConfig))
+	}
+	if mechanism != nil {
+		opts = append(opts, kgo.SASL(mechanism))
+	}
+	if clientID != "" {
+		opts = append(opts, kgo.ClientID(clientID))
+	}
+
+	return opts, release, nil
+}
+
+// consumerOpts returns the kgo options set by the message queue options of the config.
+// Topic options are left out when consuming directly assigned partitions.
+func consumerOpts(cp config.ConfigProvider, direct bool) []kgo.Opt {
+	options := cp.GetMessageQueueOptions()
+
+	isolationLevel := kgo.ReadUncommitted()
+	if options.IsolationLevel == config.ReadCommitted {
+		isolationLevel = kgo.ReadCommitted()
+	}
+
+	var balancers []kgo.GroupBalancer
+	for _, name := range options.Balancers {
+		balancers = append(balancers, groupBalancers[name]())
+	}
+
 	opts := []kgo.Opt{
-		kgo.SeedBrokers(cp.GetMessageQueueURL()),
-		kgo.ConsumeTopics(cp.GetMessageQueueTopics()...),
-		kgo.ConsumerGroup(cp.GetMessageQueueGroupID()),
-		kgo.DialTLSConfig(tlsConfig),
+		kgo.FetchMaxBytes(options.FetchMaxBytes),
+		kgo.FetchMaxPartitionBytes(options.FetchMaxPartitionBytes),
+		kgo.FetchMinBytes(options.FetchMinBytes),
+		kgo.FetchMaxWait(options.FetchMaxWait),
+		kgo.FetchIsolationLevel(isolationLevel),
+		kgo.Balancers(balancers...),
+		kgo.SessionTimeout(options.SessionTimeout),
+		kgo.HeartbeatInterval(options.HeartbeatInterval),
+		kgo.RebalanceTimeout(options.RebalanceTimeout),
+		kgo.ConsumeStartOffset(kgoOffset(options.StartOffset, false)),
+	}
+	if !options.ResetOffset.IsZero() {
+		opts = append(opts, kgo.ConsumeResetOffset(kgoOffset(options.ResetOffset, true)))
+	}
+	if options.InstanceID != "" {
+		opts = append(opts, kgo.InstanceID(options.InstanceID))
+	}
+	if options.Rack != "" {
+		opts = append(opts, kgo.Rack(options.Rack))
+	}
+	if options.TopicsRegex && !direct {
+		opts = append(opts, kgo.ConsumeRegex())
+		if len(options.ExcludeTopics) > 0 {
+			opts = append(opts, kgo.ConsumeExcludeTopics(options.ExcludeTopics...))
+		}
+	}
+
+	return opts
+}
+
+// groupBalancers maps the balancer names accepted by the config to their kgo balancers
+var groupBalancers = map[string]func() kgo.GroupBalancer{
+	config.RangeBalancer:             kgo.RangeBalancer,
+	config.RoundRobinBalancer:        kgo.RoundRobinBalancer,
+	config.StickyBalancer:            kgo.StickyBalancer,
+	config.CooperativeStickyBalancer: kgo.CooperativeStickyBalancer,
+}
+
+// messageQueueCertFields are the config fields the message queue TLS material is made of
+var messageQueueCertFields = []string{
+	"MESSAGE_QUEUE_CA", "MESSAGE_QUEUE_CRT", "MESSAGE_QUEUE_KEY", "MESSAGE_QUEUE_KEY_PASSWORD", "MESSAGE_QUEUE_P12",
+}
+
+// newTLSConfig returns a TLS config following the message queue TLS policy, that keeps
+// serving the current message queue certificates as they're rotated until unsubscribe is called
+func newTLSConfig(cp config.ConfigProvider) (tlsConfig *tls.Config, unsubscribe func(), err error) {
+	opts, err := cp.GetMessageQueueTLSPolicy().CertOptions()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certSource, err := certs.NewReloader(func() certs.Material {
+		return certs.Material{
+			CACertPEM:     cp.GetMessageQueueClientCA(),
+			ClientCertPEM: cp.GetMessageQueueClientCert(),
+			ClientKeyPEM:  cp.GetMessageQueueClientCertKey(),
+			PKCS12:        cp.GetMessageQueueClientP12(),
+			Password:      cp.GetMessageQueueClientCertKeyPassword(),
+		}
+	}, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	log := logger.New("kafka")
+	unsubscribe = cp.Subscribe(func(_ config.ConfigProvider, change config.Change) {
+		if !slices.ContainsFunc(messageQueueCertFields, change.Has) {
+			return
+		}
+
+		err := certSource.Reload()
+		if err != nil {
+			log.Error("error reloading message queue certificates", "error", err.Error())
+			return
+		}
+		log.Info("message queue certificates reloaded")
+	})
+
+	return certSource.TLSConfig(), sync.OnceFunc(unsubscribe), nil
+}
+
+// UpdateTopics makes the client consume exactly the configured topics and their retry topics,
+// adding the new topics and purging the ones no longer listed. Regex topics can't be changed at runtime.
+func UpdateTopics(client *kgo.Client, cp config.ConfigProvider, log *slog.Logger) {
+	if cp.GetMessageQueueOptions().TopicsRegex {
+		log.Warn("regex topics can't be changed at runtime - restart required", "topics", cp.GetMessageQueueTopics())
+		return
+	}
+
+	added, removed := diffTopics(client.GetConsumeTopics(), subscribedTopics(cp))
+
+	if len(added) > 0 {
+		client.AddConsumeTopics(added...)
+	}
+	if len(removed) > 0 {
+		client.PurgeTopicsFromConsuming(removed...)
+	}
+
+	log.Info("consumed topics updated", "added", added, "removed", removed)
+}
+
+// TopicChangeFunc is called with the topics consumed after a change, and the ones added and removed
+type TopicChangeFunc func(consumed, added, removed []string)
+
+// TrackTopics checks the topics consumed by client every interval until ctx is done, and logs
+// and reports the topics added and removed since the previous check. It's how the topics
+// matched by regex topics are followed as they're created and deleted.
+func TrackTopics(ctx context.Context, client *kgo.Client, interval time.Duration, log *slog.Logger, onChange TopicChangeFunc) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var consumed []string
+	for {
+		current := client.GetConsumeTopics()
+		added, removed := diffTopics(consumed, current)
+		if len(added) > 0 || len(removed) > 0 {
+			consumed = current
+			for _, topic := range added {
+				log.Info("started consuming topic", "topic", topic)
+			}
+			for _, topic := range removed {
+				log.Info("stopped consuming topic", "topic", topic)
+			}
+			onChange(consumed, added, removed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// diffTopics returns the topics of next that aren't in prev, and the topics of prev that aren't in next
+func diffTopics(prev, next []string) (added, removed []string) {
+	for _, topic := range next {
+		if !slices.Contains(prev, topic) {
+			added = append(added, topic)
+		}
+	}
+	for _, topic := range prev {
+		if !slices.Contains(next, topic) {
+			removed = append(removed, topic)
+		}
 	}
+	slices.Sort(added)
+	slices.Sort(removed)
 
-	return kgo.NewClient(opts...)
+	return added, removed
 }
@@ -0,0 +1,193 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+)
+
+// kgoOffset returns the kgo offset of o. reset selects the meaning of "none", which can't be
+// the same for the start and reset offsets (see config.Offset).
+func kgoOffset(o config.Offset, reset bool) kgo.Offset {
+	switch o.Position {
+	case config.OffsetLatest:
+		return kgo.NewOffset().AtEnd()
+	case config.OffsetNone:
+		if reset {
+			return kgo.NoResetOffset()
+		}
+		return kgo.NewOffset().AtCommitted()
+	case config.OffsetTimestamp:
+		return kgo.NewOffset().AfterMilli(o.Timestamp.UnixMilli())
+	case config.OffsetExact:
+		return kgo.NewOffset().At(o.Exact)
+	default:
+		return kgo.NewOffset().AtStart()
+	}
+}
+
+// kgoPartitionOffsets returns the kgo offsets of the partitions
+func kgoPartitionOffsets(partitions map[string]map[int32]config.Offset) map[string]map[int32]kgo.Offset {
+	offsets := map[string]map[int32]kgo.Offset{}
+	for topic, partitionOffsets := range partitions {
+		offsets[topic] = map[int32]kgo.Offset{}
+		for partition, offset := range partitionOffsets {
+			offsets[topic][partition] = kgoOffset(offset, false)
+		}
+	}
+
+	return offsets
+}
+
+// ConsumedTopics returns the topics consumed according to the config, listing the topics of
+// the cluster to match them against the regex topics if needed
+func ConsumedTopics(ctx context.Context, adm *kadm.Client, cp config.ConfigProvider) ([]string, error) {
+	options := cp.GetMessageQueueOptions()
+	if !options.TopicsRegex {
+		return subscribedTopics(cp), nil
+	}
+
+	details, err := adm.ListTopics(ctx)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to list topics"), err)
+	}
+
+	include, err := compileAll(cp.GetMessageQueueTopics())
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compileAll(options.ExcludeTopics)
+	if err != nil {
+		return nil, err
+	}
+
+	var topics []string
+	for _, topic := range details.Names() {
+		if matchesAny(include, topic) && !matchesAny(exclude, topic) {
+			topics = append(topics, topic)
+		}
+	}
+	slices.Sort(topics)
+
+	return topics, nil
+}
+
+// SeekGroupToTimestamp commits, for every partition of the consumed topics, the offset of the
+// first record produced at or after ts (or the end offset if there's none), so the group
+// reprocesses the records produced since ts. Kafka only accepts these commits while the group
+// has no active members, so this must run before the consumer joins its group.
+func SeekGroupToTimestamp(ctx context.Context, adm *kadm.Client, cp config.ConfigProvider, ts time.Time, log *slog.Logger) error {
+	topics, err := ConsumedTopics(ctx, adm, cp)
+	if err != nil {
+		return err
+	}
+	// listing the offsets of no topics lists every topic of the cluster
+	if len(topics) == 0 {
+		return errors.New("no consumed topics to seek")
+	}
+
+	listed, err := adm.ListOffsetsAfterMilli(ctx, ts.UnixMilli(), topics...)
+	if err == nil {
+		err = listed.Error()
+	}
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to list the offsets after %s", ts.Format(time.RFC3339)), err)
+	}
+
+	offsets := listed.Offsets()
+	err = commitOffsets(ctx, adm, cp.GetMessageQueueGroupID(), offsets)
+	if err != nil {
+		return err
+	}
+
+	offsets.Each(func(o kadm.Offset) {
+		log.Info("group offset set", "topic", o.Topic, "partition", o.Partition, "offset", o.At)
+	})
+	log.Info("group seeked to timestamp", "group", cp.GetMessageQueueGroupID(), "timestamp", ts.Format(time.RFC3339))
+
+	return nil
+}
+
+// CommitStartOffsets commits the partition offsets of the config for the partitions the group
+// has no committed offset for, so they're consumed from there rather than from the start offset
+func CommitStartOffsets(ctx context.Context, adm *kadm.Client, cp config.ConfigProvider, log *slog.Logger) error {
+	partitionOffsets, err := config.PartitionOffsets(cp.GetMessageQueueOptions().PartitionOffsets)
+	if err != nil || len(partitionOffsets) == 0 {
+		return err
+	}
+
+	group := cp.GetMessageQueueGroupID()
+	committed, err := adm.FetchOffsets(ctx, group)
+	if err == nil {
+		err = committed.Error()
+	}
+	if err != nil {
+		return errors.Join(errors.New("failed to fetch the committed offsets"), err)
+	}
+
+	offsets := kadm.Offsets{}
+	for topic, partitions := range partitionOffsets {
+		for partition, offset := range partitions {
+			if o, ok := committed.Lookup(topic, partition); ok && o.At >= 0 {
+				log.Info("partition already has a committed offset - ignoring its configured offset",
+					"topic", topic, "partition", partition, "committed", o.At, "configured", offset)
+				continue
+			}
+			offsets.Add(kadm.Offset{Topic: topic, Partition: partition, At: offset, LeaderEpoch: -1})
+		}
+	}
+	if len(offsets) == 0 {
+		return nil
+	}
+
+	err = commitOffsets(ctx, adm, group, offsets)
+	if err != nil {
+		return err
+	}
+
+	offsets.Each(func(o kadm.Offset) {
+		log.Info("start offset committed", "topic", o.Topic, "partition", o.Partition, "offset", o.At)
+	})
+
+	return nil
+}
+
+func commitOffsets(ctx context.Context, adm *kadm.Client, group string, offsets kadm.Offsets) error {
+	committed, err := adm.CommitOffsets(ctx, group, offsets)
+	if err == nil {
+		err = committed.Error()
+	}
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to commit offsets for group %s", group), err)
+	}
+
+	return nil
+}
+
+func compileAll(exprs []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, re)
+	}
+
+	return compiled, nil
+}
+
+func matchesAny(exprs []*regexp.Regexp, s string) bool {
+	return slices.ContainsFunc(exprs, func(re *regexp.Regexp) bool {
+		return re.MatchString(s)
+	})
+}
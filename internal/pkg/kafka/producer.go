@@ -0,0 +1,112 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+)
+
+// Producer produces the records emitted by handlers outside of the transactional mode. It's
+// connected like the consumer, with its own client.
+//
+// Emitted records are produced asynchronously and Flush reports the ones that failed, so the
+// consumer flushes the producer before committing the offsets of the records handled: an
+// offset is only committed once the records emitted while handling it are produced.
+type Producer struct {
+	client *kgo.Client
+
+	mu   sync.Mutex
+	errs []error
+}
+
+// NewProducer returns a producer sending records without a topic to the output topic, and
+// partitioning them with the configured partitioner. The producer must be closed once done with.
+func NewProducer(ctx context.Context, cp config.ConfigProvider, options ...Option) (*Producer, error) {
+	opts, release, err := connectionOpts(ctx, cp, options...)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, producerOpts(cp)...)
+
+	client, err := newKgoClient(opts, release)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Producer{client: client}, nil
+}
+
+// producerOpts returns the kgo options set by the output options of the config
+func producerOpts(cp config.ConfigProvider) []kgo.Opt {
+	options := cp.GetMessageQueueOptions()
+
+	opts := []kgo.Opt{
+		kgo.RecordPartitioner(partitioners[options.Partitioner]()),
+	}
+	if options.OutputTopic != "" {
+		opts = append(opts, kgo.DefaultProduceTopic(options.OutputTopic))
+	}
+
+	return opts
+}
+
+// partitioners maps the partitioner names accepted by the config to their kgo partitioners
+var partitioners = map[string]func() kgo.Partitioner{
+	// the kgo default: 64KiB sticky batches, adapting to slow brokers, with keyed records hashed
+	config.UniformBytesPartitioner: func() kgo.Partitioner { return kgo.UniformBytesPartitioner(64<<10, true, true, nil) },
+	config.StickyKeyPartitioner:    func() kgo.Partitioner { return kgo.StickyKeyPartitioner(nil) },
+	config.RoundRobinPartitioner:   kgo.RoundRobinPartitioner,
+	config.ManualPartitioner:       kgo.ManualPartitioner,
+}
+
+// Produce produces r and waits for it to be acknowledged
+func (p *Producer) Produce(ctx context.Context, r *kgo.Record) error {
+	return p.client.ProduceSync(ctx, r).FirstErr()
+}
+
+// Emit produces r asynchronously. The error of r, if it fails, is returned by the next Flush.
+func (p *Producer) Emit(ctx context.Context, r *kgo.Record) error {
+	p.client.Produce(ctx, r, func(r *kgo.Record, err error) {
+		if err != nil {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.errs = append(p.errs, err)
+		}
+	})
+
+	return nil
+}
+
+// EmitSync produces r and waits for it to be acknowledged
+func (p *Producer) EmitSync(ctx context.Context, r *kgo.Record) error {
+	return p.Produce(ctx, r)
+}
+
+// Flush waits for the records produced so far to be acknowledged and returns the errors of the
+// records emitted since the previous flush that failed
+func (p *Producer) Flush(ctx context.Context) error {
+	err := p.client.Flush(ctx)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	errs := p.errs
+	p.errs = nil
+	if len(errs) > 0 {
+		return errors.Join(append([]error{errors.New("failed to produce emitted records")}, errs...)...)
+	}
+
+	return nil
+}
+
+// Close flushes the records produced so far and closes the client
+func (p *Producer) Close(ctx context.Context) {
+	_ = p.client.Flush(ctx)
+	p.client.Close()
+}
@@ -0,0 +1,158 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+)
+
+// ReplaySourceHeader is added to the replayed records, telling the "<topic>/<partition>/<offset>"
+// of the dead letter record they were replayed from
+const ReplaySourceHeader = "replay.source"
+
+// Replay returns the record to republish for r, consumed from a dead letter topic: r, sent to
+// topic or, if empty, to the topic it was consumed from before failing (see DeadLetter), without
+// the dead letter and retry headers. Replayed to the topic it was consumed from, the record has
+// the partition and offset it was consumed at, so handlers see its original position. It returns
+// false if r doesn't tell where it comes from.
+func Replay(r *kgo.Record, topic string) (*kgo.Record, bool) {
+	origin := topic == ""
+	if origin {
+		topic, _ = header(r, DLQTopicHeader)
+	}
+	if topic == "" {
+		return nil, false
+	}
+
+	headers := make([]kgo.RecordHeader, 0, len(r.Headers)+1)
+	for _, h := range r.Headers {
+		if !slices.Contains(dlqHeaders, h.Key) && !slices.Contains(retryHeaders, h.Key) && h.Key != ReplaySourceHeader {
+			headers = append(headers, h)
+		}
+	}
+	source := r.Topic + "/" + strconv.FormatInt(int64(r.Partition), 10) + "/" + strconv.FormatInt(r.Offset, 10)
+	headers = append(headers, kgo.RecordHeader{Key: ReplaySourceHeader, Value: []byte(source)})
+
+	replayed := &kgo.Record{
+		Topic:     topic,
+		Key:       r.Key,
+		Value:     r.Value,
+		Headers:   headers,
+		Timestamp: r.Timestamp,
+	}
+	if origin {
+		replayed.Partition, replayed.Offset = deadLetterPosition(r)
+	}
+
+	return replayed, true
+}
+
+// deadLetterPosition returns the partition and offset r, consumed from a dead letter topic, was
+// consumed at before failing, or zeros if r doesn't tell
+func deadLetterPosition(r *kgo.Record) (partition int32, offset int64) {
+	if val, ok := header(r, DLQPartitionHeader); ok {
+		if p, err := strconv.ParseInt(val, 10, 32); err == nil {
+			partition = int32(p)
+		}
+	}
+	if val, ok := header(r, DLQOffsetHeader); ok {
+		if o, err := strconv.ParseInt(val, 10, 64); err == nil {
+			offset = o
+		}
+	}
+	return partition, offset
+}
+
+// OffsetRange is the range of offsets of a partition, End excluded
+type OffsetRange struct {
+	Start int64
+	End   int64
+}
+
+// Empty reports whether the range has no offsets
+func (r OffsetRange) Empty() bool {
+	return r.Start >= r.End
+}
+
+// OffsetRanges returns the ranges of offsets of the partitions of topic, from the from offset
+// included to the to offset excluded, bounded by the offsets of the partitions.
+// A timestamp is the offset of the first record produced at or after it.
+func OffsetRanges(ctx context.Context, adm *kadm.Client, topic string, from, to config.Offset) (map[int32]OffsetRange, error) {
+	first, err := listOffsets(ctx, adm, topic, config.Offset{Position: config.OffsetEarliest})
+	if err != nil {
+		return nil, err
+	}
+	end, err := listOffsets(ctx, adm, topic, config.Offset{Position: config.OffsetLatest})
+	if err != nil {
+		return nil, err
+	}
+	if len(end) == 0 {
+		return nil, fmt.Errorf("topic %s not found", topic)
+	}
+
+	starts, err := listOffsets(ctx, adm, topic, from)
+	if err != nil {
+		return nil, err
+	}
+	ends, err := listOffsets(ctx, adm, topic, to)
+	if err != nil {
+		return nil, err
+	}
+
+	ranges := map[int32]OffsetRange{}
+	for partition, e := range end {
+		start, stop := first[partition], e
+		if o, ok := starts[partition]; ok && o > start {
+			start = o
+		}
+		if o, ok := ends[partition]; ok && o < stop {
+			stop = o
+		}
+		ranges[partition] = OffsetRange{Start: start, End: stop}
+	}
+
+	return ranges, nil
+}
+
+// listOffsets returns the offset o of every partition of topic
+func listOffsets(ctx context.Context, adm *kadm.Client, topic string, o config.Offset) (map[int32]int64, error) {
+	var listed kadm.ListedOffsets
+	var err error
+	switch o.Position {
+	case config.OffsetLatest:
+		// the last stable offset, as the records are read committed
+		listed, err = adm.ListCommittedOffsets(ctx, topic)
+	case config.OffsetTimestamp:
+		listed, err = adm.ListOffsetsAfterMilli(ctx, o.Timestamp.UnixMilli(), topic)
+	case config.OffsetExact:
+		// every partition, bounded by the caller
+		listed, err = adm.ListEndOffsets(ctx, topic)
+	case config.OffsetEarliest:
+		listed, err = adm.ListStartOffsets(ctx, topic)
+	default:
+		return nil, fmt.Errorf("offset %q can't bound a range", o.String())
+	}
+	if err == nil {
+		err = listed.Error()
+	}
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to list the %s offsets of %s", o, topic), err)
+	}
+
+	offsets := map[int32]int64{}
+	listed.Each(func(l kadm.ListedOffset) {
+		offsets[l.Partition] = l.Offset
+		if o.Position == config.OffsetExact {
+			offsets[l.Partition] = o.Exact
+		}
+	})
+
+	return offsets, nil
+}
@@ -0,0 +1,77 @@
+package kafka_test
+
+import (
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/kafka"
+)
+
+func TestReplay(t *testing.T) {
+	r := &kgo.Record{
+		Topic:     "data-set-1-dlq",
+		Partition: 2,
+		Offset:    40,
+		Key:       []byte("customer-1"),
+		Value:     []byte(`{"id": 1}`),
+		Headers: []kgo.RecordHeader{
+			{Key: "trace-id", Value: []byte("abc")},
+			{Key: "retry.policy", Value: []byte("fast")},
+			{Key: kafka.RetryTopicHeader, Value: []byte("data-set-1")},
+			{Key: kafka.RetryAttemptHeader, Value: []byte("3")},
+			{Key: kafka.DLQTopicHeader, Value: []byte("data-set-1")},
+			{Key: kafka.DLQPartitionHeader, Value: []byte("1")},
+			{Key: kafka.DLQOffsetHeader, Value: []byte("1500")},
+			{Key: kafka.DLQErrorHeader, Value: []byte("invalid record")},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		record        *kgo.Record
+		topic         string
+		wantTopic     string
+		wantPartition int32
+		wantOffset    int64
+		wantOK        bool
+	}{
+		{name: "origin topic", record: r, wantTopic: "data-set-1", wantPartition: 1, wantOffset: 1500, wantOK: true},
+		{name: "other topic", record: r, topic: "data-set-2", wantTopic: "data-set-2", wantOK: true},
+		{name: "unknown origin", record: &kgo.Record{Topic: "data-set-1-dlq"}, wantOK: false},
+		{name: "unknown origin with topic", record: &kgo.Record{Topic: "data-set-1-dlq"}, topic: "data-set-2", wantTopic: "data-set-2", wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replayed, ok := kafka.Replay(tt.record, tt.topic)
+			if ok != tt.wantOK {
+				t.Fatalf("expected ok %t but got %t", tt.wantOK, ok)
+			}
+			if ok && replayed.Topic != tt.wantTopic {
+				t.Fatalf("expected topic %s but got %s", tt.wantTopic, replayed.Topic)
+			}
+			if ok && (replayed.Partition != tt.wantPartition || replayed.Offset != tt.wantOffset) {
+				t.Fatalf("expected position %d/%d but got %d/%d", tt.wantPartition, tt.wantOffset, replayed.Partition, replayed.Offset)
+			}
+		})
+	}
+
+	replayed, _ := kafka.Replay(r, "")
+	if string(replayed.Key) != "customer-1" || string(replayed.Value) != `{"id": 1}` {
+		t.Fatalf("expected the record to be replayed as is but got %+v", replayed)
+	}
+	want := map[string]string{
+		"trace-id":               "abc",
+		"retry.policy":           "fast",
+		kafka.ReplaySourceHeader: "data-set-1-dlq/2/40",
+	}
+	if len(replayed.Headers) != len(want) {
+		t.Fatalf("expected headers %v but got %v", want, replayed.Headers)
+	}
+	for _, header := range replayed.Headers {
+		if want[header.Key] != string(header.Value) {
+			t.Fatalf("expected header %s to be %q but got %q", header.Key, want[header.Key], header.Value)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package kafka
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+)
+
+// Headers added to the records sent to the retry topics
+const (
+	RetryTopicHeader     = "retry.topic"
+	RetryPartitionHeader = "retry.partition"
+	RetryOffsetHeader    = "retry.offset"
+	RetryAttemptHeader   = "retry.attempt"
+	RetryNotBeforeHeader = "retry.not-before"
+	RetryErrorHeader     = "retry.error"
+)
+
+// retryHeaders are the headers added to the records sent to the retry topics
+var retryHeaders = []string{
+	RetryTopicHeader,
+	RetryPartitionHeader,
+	RetryOffsetHeader,
+	RetryAttemptHeader,
+	RetryNotBeforeHeader,
+	RetryErrorHeader,
+}
+
+// RetryTopic returns the name of the retry topic of topic for delay e.g. "orders.retry.10m"
+func RetryTopic(topic string, delay time.Duration) string {
+	// 1h0m0s -> 1h, 10m0s -> 10m
+	name := delay.String()
+	if strings.HasSuffix(name, "m0s") {
+		name = strings.TrimSuffix(name, "0s")
+	}
+	if strings.HasSuffix(name, "h0m") {
+		name = strings.TrimSuffix(name, "0m")
+	}
+
+	return topic + ".retry." + name
+}
+
+// subscribedTopics returns the configured topics and, unless they're regular expressions, their
+// retry topics
+func subscribedTopics(cp config.ConfigProvider) []string {
+	topics := cp.GetMessageQueueTopics()
+	options := cp.GetMessageQueueOptions()
+	if options.TopicsRegex || len(options.RetryDelays) == 0 {
+		return topics
+	}
+
+	subscribed := slices.Clone(topics)
+	for _, topic := range topics {
+		for _, delay := range options.RetryDelays {
+			subscribed = append(subscribed, RetryTopic(topic, delay))
+		}
+	}
+
+	return subscribed
+}
+
+// OriginTopic returns the topic r was first consumed from: its own topic, or the topic it was
+// retried from if it comes from a retry topic
+func OriginTopic(r *kgo.Record) string {
+	if topic, ok := header(r, RetryTopicHeader); ok {
+		return topic
+	}
+	return r.Topic
+}
+
+// OriginPosition returns the partition and offset r was first consumed at: its own, or the ones
+// it was retried from if it comes from a retry topic
+func OriginPosition(r *kgo.Record) (partition int32, offset int64) {
+	partition, offset = r.Partition, r.Offset
+	if val, ok := header(r, RetryPartitionHeader); ok {
+		if p, err := strconv.ParseInt(val, 10, 32); err == nil {
+			partition = int32(p)
+		}
+	}
+	if val, ok := header(r, RetryOffsetHeader); ok {
+		if o, err := strconv.ParseInt(val, 10, 64); err == nil {
+			offset = o
+		}
+	}
+	return partition, offset
+}
+
+// RetryNotBefore returns the time r, consumed from a retry topic, must not be handled before
+func RetryNotBefore(r *kgo.Record) (time.Time, bool) {
+	val, ok := header(r, RetryNotBeforeHeader)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	ms, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.UnixMilli(ms), true
+}
+
+// NextRetry returns the record to send to the next retry topic for r, which failed with err, or
+// false if r was retried after every delay. The retry record is r, with headers telling where
+// it was first consumed, which attempt it is, why it failed and when it's due.
+func NextRetry(r *kgo.Record, delays []time.Duration, err error, now time.Time) (*kgo.Record, bool) {
+	attempt := 0
+	if val, ok := header(r, RetryAttemptHeader); ok {
+		attempt, _ = strconv.Atoi(val)
+	}
+	if attempt >= len(delays) {
+		return nil, false
+	}
+
+	delay := delays[attempt]
+	origin := OriginTopic(r)
+	partition, offset := OriginPosition(r)
+
+	headers := make([]kgo.RecordHeader, 0, len(r.Headers)+6)
+	for _, h := range r.Headers {
+		if !slices.Contains(retryHeaders, h.Key) {
+			headers = append(headers, h)
+		}
+	}
+	headers = append(headers,
+		kgo.RecordHeader{Key: RetryTopicHeader, Value: []byte(origin)},
+		kgo.RecordHeader{Key: RetryPartitionHeader, Value: []byte(strconv.FormatInt(int64(partition), 10))},
+		kgo.RecordHeader{Key: RetryOffsetHeader, Value: []byte(strconv.FormatInt(offset, 10))},
+		kgo.RecordHeader{Key: RetryAttemptHeader, Value: []byte(strconv.Itoa(attempt + 1))},
+		kgo.RecordHeader{Key: RetryNotBeforeHeader, Value: []byte(strconv.FormatInt(now.Add(delay).UnixMilli(), 10))},
+		kgo.RecordHeader{Key: RetryErrorHeader, Value: []byte(err.Error())},
+	)
+
+	return &kgo.Record{
+		Topic:     RetryTopic(origin, delay),
+		Key:       r.Key,
+		Value:     r.Value,
+		Headers:   headers,
+		Timestamp: r.Timestamp,
+	}, true
+}
+
+// header returns the value of the last name header of r
+func header(r *kgo.Record, name string) (string, bool) {
+	val, ok := "", false
+	for _, h := range r.Headers {
+		if h.Key == name {
+			val, ok = string(h.Value), true
+		}
+	}
+	return val, ok
+}
@@ -0,0 +1,92 @@
+package kafka_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/kafka"
+)
+
+func TestRetryTopic(t *testing.T) {
+	tests := map[time.Duration]string{
+		30 * time.Second:        "orders.retry.30s",
+		time.Minute:             "orders.retry.1m",
+		10 * time.Minute:        "orders.retry.10m",
+		90 * time.Second:        "orders.retry.1m30s",
+		time.Hour:               "orders.retry.1h",
+		90 * time.Minute:        "orders.retry.1h30m",
+		time.Hour + time.Second: "orders.retry.1h0m1s",
+	}
+
+	for delay, want := range tests {
+		if got := kafka.RetryTopic("orders", delay); got != want {
+			t.Errorf("expected retry topic %s for %s but got %s", want, delay, got)
+		}
+	}
+}
+
+func TestNextRetry(t *testing.T) {
+	delays := []time.Duration{time.Minute, 10 * time.Minute}
+	now := time.UnixMilli(1_700_000_000_000)
+	errInvalid := errors.New("sink unavailable")
+
+	r := &kgo.Record{
+		Topic:     "orders",
+		Partition: 5,
+		Offset:    1500,
+		Key:       []byte("customer-1"),
+		Value:     []byte("order"),
+		Headers:   []kgo.RecordHeader{{Key: "trace-id", Value: []byte("abc")}, {Key: "retry.policy", Value: []byte("fast")}},
+	}
+
+	first, ok := kafka.NextRetry(r, delays, errInvalid, now)
+	if !ok || first.Topic != "orders.retry.1m" || string(first.Key) != "customer-1" {
+		t.Fatalf("expected the record to be retried in orders.retry.1m but got %+v", first)
+	}
+	if notBefore, ok := kafka.RetryNotBefore(first); !ok || !notBefore.Equal(now.Add(time.Minute)) {
+		t.Fatalf("expected the retry to be due in a minute but got %s", notBefore)
+	}
+	if _, ok := kafka.RetryNotBefore(r); ok {
+		t.Fatal("expected records not retried to have no due time")
+	}
+
+	// consumed from the retry topic
+	first.Partition, first.Offset = 2, 42
+	second, ok := kafka.NextRetry(first, delays, errInvalid, now)
+	if !ok || second.Topic != "orders.retry.10m" || kafka.OriginTopic(second) != "orders" {
+		t.Fatalf("expected the record to be retried in orders.retry.10m but got %+v", second)
+	}
+	if len(second.Headers) != len(first.Headers) {
+		t.Fatalf("expected the retry headers to be replaced but got %v", second.Headers)
+	}
+	if !slices.ContainsFunc(second.Headers, func(h kgo.RecordHeader) bool { return h.Key == "retry.policy" && string(h.Value) == "fast" }) {
+		t.Fatalf("expected the retry.policy header of the record to be kept but got %v", second.Headers)
+	}
+
+	second.Topic = "orders.retry.10m"
+	if _, ok := kafka.NextRetry(second, delays, errInvalid, now); ok {
+		t.Fatal("expected no retry after every delay")
+	}
+
+	// consumed from the last retry topic, the dead letter record tells where it was first consumed
+	second.Partition, second.Offset = 0, 7
+	dl := kafka.DeadLetter("orders-dlq", second, errInvalid)
+	want := map[string]string{
+		kafka.DLQTopicHeader:     "orders",
+		kafka.DLQPartitionHeader: "5",
+		kafka.DLQOffsetHeader:    "1500",
+	}
+	for _, h := range dl.Headers {
+		if v, ok := want[h.Key]; ok && string(h.Value) != v {
+			t.Fatalf("expected the dead letter header %s to be %q but got %q", h.Key, v, h.Value)
+		}
+	}
+
+	if _, ok := kafka.NextRetry(r, nil, errInvalid, now); ok {
+		t.Fatal("expected no retry without retry delays")
+	}
+}
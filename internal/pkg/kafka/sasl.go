@@ -0,0 +1,196 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/oauth"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+)
+
+// tokenExpiryMargin is how long before their expiry cached tokens are renewed
+const tokenExpiryMargin = time.Minute
+
+// tokenRequestTimeout bounds the requests for tokens to the configured token URL, so an
+// unresponsive token endpoint fails the authentication instead of hanging the connection
+const tokenRequestTimeout = 30 * time.Second
+
+// TokenSource returns the token used to authenticate with OAUTHBEARER.
+// Token is called for every new connection so implementations should cache their tokens.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenSourceFunc adapts a func to a TokenSource
+type TokenSourceFunc func(ctx context.Context) (string, error)
+
+func (f TokenSourceFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// newSASLMechanism returns the SASL mechanism selected by the message queue SASL config,
+// or nil if SASL is disabled. Credentials are read from cp on every authentication so
+// rotated credentials are used by the next connections.
+func newSASLMechanism(cp config.ConfigProvider, tokenSource TokenSource) (sasl.Mechanism, error) {
+	switch cp.GetMessageQueueSASL().Mechanism {
+	case "":
+		return nil, nil
+	case config.SASLPlain:
+		return plain.Plain(func(context.Context) (plain.Auth, error) {
+			saslConfig := cp.GetMessageQueueSASL()
+			return plain.Auth{User: saslConfig.Username, Pass: saslConfig.Password}, nil
+		}), nil
+	case config.SASLScramSHA256:
+		return scram.Sha256(scramAuth(cp)), nil
+	case config.SASLScramSHA512:
+		return scram.Sha512(scramAuth(cp)), nil
+	case config.SASLOAuthBearer:
+		if tokenSource == nil {
+			tokenSource = newConfigTokenSource(cp)
+		}
+		return oauth.Oauth(func(ctx context.Context) (oauth.Auth, error) {
+			token, err := tokenSource.Token(ctx)
+			if err != nil {
+				return oauth.Auth{}, errors.Join(errors.New("failed to get OAuth token"), err)
+			}
+			return oauth.Auth{Token: token}, nil
+		}), nil
+	default:
+		return nil, fmt.Errorf("unsupported SASL mechanism %q", cp.GetMessageQueueSASL().Mechanism)
+	}
+}
+
+func scramAuth(cp config.ConfigProvider) func(context.Context) (scram.Auth, error) {
+	return func(context.Context) (scram.Auth, error) {
+		saslConfig := cp.GetMessageQueueSASL()
+		return scram.Auth{User: saslConfig.Username, Pass: saslConfig.Password}, nil
+	}
+}
+
+// newConfigTokenSource returns the token source used when none is given to NewClient: the
+// configured token if there is one, or tokens from the configured token URL otherwise
+func newConfigTokenSource(cp config.ConfigProvider) TokenSource {
+	clientCredentials := NewClientCredentialsTokenSource(&http.Client{Timeout: tokenRequestTimeout}, func() ClientCredentials {
+		saslConfig := cp.GetMessageQueueSASL()
+		return ClientCredentials{
+			TokenURL:     saslConfig.OAuthTokenURL,
+			ClientID:     saslConfig.OAuthClientID,
+			ClientSecret: saslConfig.OAuthClientSecret,
+			Scopes:       saslConfig.OAuthScopes,
+		}
+	})
+
+	return TokenSourceFunc(func(ctx context.Context) (string, error) {
+		if token := cp.GetMessageQueueSASL().OAuthToken; token != "" {
+			return token, nil
+		}
+		return clientCredentials.Token(ctx)
+	})
+}
+
+// ClientCredentials are the parameters of an OAuth client credentials grant
+type ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// ClientCredentialsTokenSource gets tokens with the OAuth client credentials grant and caches
+// them until shortly before they expire, or until the credentials change
+type ClientCredentialsTokenSource struct {
+	client      *http.Client
+	credentials func() ClientCredentials
+
+	mu        sync.Mutex
+	token     string
+	expiry    time.Time
+	fetchedBy ClientCredentials
+}
+
+// NewClientCredentialsTokenSource returns a token source getting its tokens with the credentials
+// currently returned by credentials
+func NewClientCredentialsTokenSource(client *http.Client, credentials func() ClientCredentials) *ClientCredentialsTokenSource {
+	return &ClientCredentialsTokenSource{
+		client:      client,
+		credentials: credentials,
+	}
+}
+
+func (ts *ClientCredentialsTokenSource) Token(ctx context.Context) (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	credentials := ts.credentials()
+	cached := ts.token != "" && time.Now().Before(ts.expiry) && credentialsEqual(credentials, ts.fetchedBy)
+	if cached {
+		return ts.token, nil
+	}
+
+	token, expiresIn, err := ts.fetch(ctx, credentials)
+	if err != nil {
+		return "", err
+	}
+
+	ts.token = token
+	ts.fetchedBy = credentials
+	// tokens without an expiry are fetched again for every connection
+	ts.expiry = time.Now().Add(expiresIn - tokenExpiryMargin)
+
+	return token, nil
+}
+
+// fetch requests a new token from the token URL
+func (ts *ClientCredentialsTokenSource) fetch(ctx context.Context, credentials ClientCredentials) (string, time.Duration, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(credentials.Scopes) > 0 {
+		form.Set("scope", strings.Join(credentials.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, credentials.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(credentials.ClientID), url.QueryEscape(credentials.ClientSecret))
+
+	resp, err := ts.client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("token request failed with status %s", resp.Status)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return "", 0, errors.Join(errors.New("failed to decode token response"), err)
+	}
+	if body.AccessToken == "" {
+		return "", 0, errors.New("token response has no access token")
+	}
+
+	return body.AccessToken, time.Duration(body.ExpiresIn) * time.Second, nil
+}
+
+func credentialsEqual(a, b ClientCredentials) bool {
+	return a.TokenURL == b.TokenURL && a.ClientID == b.ClientID && a.ClientSecret == b.ClientSecret &&
+		strings.Join(a.Scopes, " ") == strings.Join(b.Scopes, " ")
+}
@@ -0,0 +1,82 @@
+package kafka_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/kafka"
+)
+
+func TestClientCredentialsTokenSource(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		clientID, clientSecret, _ := r.BasicAuth()
+		if r.PostFormValue("grant_type") != "client_credentials" || clientSecret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		requests++
+		fmt.Fprintf(w, `{"access_token":"%s-%d-%s","expires_in":3600}`, clientID, requests, r.PostFormValue("scope"))
+	}))
+	t.Cleanup(server.Close)
+
+	credentials := kafka.ClientCredentials{
+		TokenURL:     server.URL,
+		ClientID:     "consumer",
+		ClientSecret: "secret",
+		Scopes:       []string{"kafka", "read"},
+	}
+	tokenSource := kafka.NewClientCredentialsTokenSource(server.Client(), func() kafka.ClientCredentials {
+		mu.Lock()
+		defer mu.Unlock()
+		return credentials
+	})
+
+	tests := []struct {
+		name        string
+		credentials func(*kafka.ClientCredentials)
+		token       string
+		err         bool
+	}{
+		{name: "first token", token: "consumer-1-kafka read"},
+		{name: "cached token", token: "consumer-1-kafka read"},
+		{name: "rotated secret", credentials: func(c *kafka.ClientCredentials) { c.ClientSecret = "rotated" }, err: true},
+		{name: "new client ID", credentials: func(c *kafka.ClientCredentials) {
+			c.ClientID = "other"
+			c.ClientSecret = "secret"
+		}, token: "other-2-kafka read"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.credentials != nil {
+				mu.Lock()
+				tt.credentials(&credentials)
+				mu.Unlock()
+			}
+
+			token, err := tokenSource.Token(context.Background())
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error getting token: %v", err)
+			}
+			if token != tt.token {
+				t.Fatalf("expected token %q but got %q", tt.token, token)
+			}
+		})
+	}
+}
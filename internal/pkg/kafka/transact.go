@@ -0,0 +1,111 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+)
+
+// NewTransactSession returns a session consuming the configured topics as part of the group and
+// producing transactionally, for the exactly-once mode (see config.KafkaOptions). Records are
+// consumed with the read_committed isolation level whatever the configured level.
+func NewTransactSession(ctx context.Context, cp config.ConfigProvider, options ...Option) (*kgo.GroupTransactSession, error) {
+	opts, release, err := connectionOpts(ctx, cp, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	kafkaOptions := cp.GetMessageQueueOptions()
+	opts = append(opts,
+		kgo.ConsumeTopics(cp.GetMessageQueueTopics()...),
+		kgo.ConsumerGroup(cp.GetMessageQueueGroupID()),
+	)
+	opts = append(opts, consumerOpts(cp, false)...)
+	opts = append(opts,
+		kgo.FetchIsolationLevel(kgo.ReadCommitted()),
+		kgo.RequireStableFetchOffsets(),
+		kgo.TransactionalID(TransactionalID(cp)),
+		kgo.TransactionTimeout(kafkaOptions.TransactionTimeout),
+	)
+	opts = append(opts, producerOpts(cp)...)
+
+	session, err := kgo.NewGroupTransactSession(opts...)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// TransactionalID returns the transactional ID of this consumer: the configured prefix, or the
+// group ID, followed by the instance ID or the hostname
+func TransactionalID(cp config.ConfigProvider) string {
+	options := cp.GetMessageQueueOptions()
+
+	prefix := options.TransactionalIDPrefix
+	if prefix == "" {
+		prefix = cp.GetMessageQueueGroupID()
+	}
+
+	instance := options.InstanceID
+	if instance == "" {
+		// pod names are unique, and stable in a StatefulSet
+		instance, _ = os.Hostname()
+	}
+
+	return prefix + "-" + instance
+}
+
+// TransactEmitter produces the records emitted by handlers in the current transaction of a
+// session. Records are produced asynchronously and Flush reports the ones that failed.
+type TransactEmitter struct {
+	sess *kgo.GroupTransactSession
+
+	mu   sync.Mutex
+	errs []error
+}
+
+// NewTransactEmitter returns an emitter for the transaction begun by sess
+func NewTransactEmitter(sess *kgo.GroupTransactSession) *TransactEmitter {
+	return &TransactEmitter{sess: sess}
+}
+
+func (e *TransactEmitter) Emit(ctx context.Context, r *kgo.Record) error {
+	e.sess.Produce(ctx, r, func(r *kgo.Record, err error) {
+		if err != nil {
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			e.errs = append(e.errs, err)
+		}
+	})
+
+	return nil
+}
+
+// EmitSync produces r in the transaction and waits for it to be acknowledged
+func (e *TransactEmitter) EmitSync(ctx context.Context, r *kgo.Record) error {
+	return e.sess.ProduceSync(ctx, r).FirstErr()
+}
+
+// Flush waits for the emitted records to be produced and returns the errors of the ones that
+// failed, in which case the transaction must be aborted
+func (e *TransactEmitter) Flush(ctx context.Context) error {
+	err := e.sess.Client().Flush(ctx)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.errs) > 0 {
+		return errors.Join(append([]error{errors.New("failed to produce emitted records")}, e.errs...)...)
+	}
+
+	return nil
+}
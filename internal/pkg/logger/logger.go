@@ -7,18 +7,36 @@ import (
 	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
 )
 
-var root *slog.Logger
+var (
+	root  *slog.Logger
+	level slog.LevelVar
+)
 
 func Initialize(cp config.ConfigProvider) {
-	handlerOptions := slog.HandlerOptions{}
+	SetLevel(cp)
 
-	if cp.IsDevelopment() {
-		handlerOptions.Level = slog.LevelDebug
+	handlerOptions := slog.HandlerOptions{
+		Level: &level,
 	}
 
 	root = slog.New(slog.NewJSONHandler(os.Stdout, &handlerOptions))
 }
 
+// SetLevel sets the level of every logger from the config. It's safe to call at any time,
+// e.g. when the config is reloaded.
+// Without an explicit level, development stages log at debug level and the rest at info.
+func SetLevel(cp config.ConfigProvider) {
+	switch {
+	case cp.GetLogLevel() != "":
+		// the config validation makes sure the level is valid
+		_ = level.UnmarshalText([]byte(cp.GetLogLevel()))
+	case cp.IsDevelopment():
+		level.Set(slog.LevelDebug)
+	default:
+		level.Set(slog.LevelInfo)
+	}
+}
+
 func New(name string) *slog.Logger {
 	return root.With("package", name)
 }
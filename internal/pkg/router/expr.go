@@ -0,0 +1,350 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// expr is a condition over a record
+type expr interface {
+	eval(r *record) bool
+}
+
+// record is a record being matched, with its value decoded on first use
+type record struct {
+	*kgo.Record
+
+	decoded bool
+	value   any
+}
+
+type and struct{ left, right expr }
+
+func (e and) eval(r *record) bool { return e.left.eval(r) && e.right.eval(r) }
+
+type or struct{ left, right expr }
+
+func (e or) eval(r *record) bool { return e.left.eval(r) || e.right.eval(r) }
+
+type not struct{ expr expr }
+
+func (e not) eval(r *record) bool { return !e.expr.eval(r) }
+
+// comparison compares a field of the record with a literal. A missing field only matches the
+// != operator.
+type comparison struct {
+	field   field
+	op      string
+	literal string
+	re      *regexp.Regexp
+}
+
+func (e comparison) eval(r *record) bool {
+	val, ok := e.field.lookup(r)
+	if e.op == "exists" {
+		return ok
+	}
+	if !ok {
+		return e.op == "!="
+	}
+
+	switch e.op {
+	case "==":
+		return val == e.literal
+	case "!=":
+		return val != e.literal
+	case "prefix":
+		return strings.HasPrefix(val, e.literal)
+	case "suffix":
+		return strings.HasSuffix(val, e.literal)
+	case "contains":
+		return strings.Contains(val, e.literal)
+	case "matches":
+		return e.re.MatchString(val)
+	}
+
+	return false
+}
+
+// field is a part of a record: topic, key, header.<name>, value or value.<dot separated path>
+type field struct {
+	kind string
+	name string
+	path []string
+}
+
+func parseField(s string) (field, error) {
+	kind, name, _ := strings.Cut(s, ".")
+	switch {
+	case kind == "topic" && name == "", kind == "key" && name == "":
+		return field{kind: kind}, nil
+	case kind == "header" && name != "":
+		return field{kind: kind, name: name}, nil
+	case kind == "value" && name == "":
+		return field{kind: kind}, nil
+	case kind == "value":
+		return field{kind: kind, name: name, path: strings.Split(name, ".")}, nil
+	}
+
+	return field{}, fmt.Errorf("unknown field %q - must be topic, key, header.<name>, value or value.<path>", s)
+}
+
+// lookup returns the field of r as a string. JSON strings are used as is, and other JSON values
+// as their JSON.
+func (f field) lookup(r *record) (string, bool) {
+	switch f.kind {
+	case "topic":
+		return r.Topic, true
+	case "key":
+		return string(r.Key), r.Key != nil
+	case "header":
+		val, ok := "", false
+		for _, header := range r.Headers {
+			if header.Key == f.name {
+				val, ok = string(header.Value), true
+			}
+		}
+		return val, ok
+	}
+
+	if f.path == nil {
+		return string(r.Value), r.Value != nil
+	}
+
+	if !r.decoded {
+		r.decoded = true
+		decoder := json.NewDecoder(bytes.NewReader(r.Value))
+		decoder.UseNumber()
+		if err := decoder.Decode(&r.value); err != nil {
+			r.value = nil
+		}
+	}
+
+	val := r.value
+	for _, key := range f.path {
+		object, ok := val.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		if val, ok = object[key]; !ok {
+			return "", false
+		}
+	}
+
+	switch v := val.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	default:
+		encoded, err := json.Marshal(v)
+		return string(encoded), err == nil
+	}
+}
+
+// token kinds
+const (
+	tokenWord   = "word"
+	tokenString = "string"
+	tokenSymbol = "symbol"
+)
+
+type token struct {
+	kind string
+	text string
+}
+
+// tokenize splits an expression into words, quoted strings and the && || ! ( ) == != symbols
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			str, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at %d: %w", i, err)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: str})
+			i = end + 1
+		case strings.HasPrefix(s[i:], "&&"), strings.HasPrefix(s[i:], "||"),
+			strings.HasPrefix(s[i:], "=="), strings.HasPrefix(s[i:], "!="):
+			tokens = append(tokens, token{kind: tokenSymbol, text: s[i : i+2]})
+			i += 2
+		case c == '!' || c == '(' || c == ')':
+			tokens = append(tokens, token{kind: tokenSymbol, text: string(c)})
+			i++
+		default:
+			end := i
+			for end < len(s) && !unicode.IsSpace(rune(s[end])) && !strings.ContainsRune(`"!()&|=`, rune(s[end])) {
+				end++
+			}
+			if end == i {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: s[i:end]})
+			i = end
+		}
+	}
+
+	return tokens, nil
+}
+
+// parser parses expressions with the grammar, where && binds tighter than ||:
+//
+//	expr       = and { "||" and }
+//	and        = unary { "&&" unary }
+//	unary      = "!" unary | "(" expr ")" | comparison
+//	comparison = field "exists" | field op literal
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parseExpr(s string) (expr, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+
+	p := &parser{tokens: tokens}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+
+	return e, nil
+}
+
+func (p *parser) next() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	p.pos++
+	return p.tokens[p.pos-1], true
+}
+
+func (p *parser) accept(symbol string) bool {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenSymbol && p.tokens[p.pos].text == symbol {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) or() (expr, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = or{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (expr, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = and{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (expr, error) {
+	if p.accept("!") {
+		e, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return not{expr: e}, nil
+	}
+
+	if p.accept("(") {
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return e, nil
+	}
+
+	return p.comparison()
+}
+
+func (p *parser) comparison() (expr, error) {
+	tok, ok := p.next()
+	if !ok || tok.kind != tokenWord {
+		return nil, fmt.Errorf("expected a field")
+	}
+	f, err := parseField(tok.text)
+	if err != nil {
+		return nil, err
+	}
+
+	tok, ok = p.next()
+	if !ok {
+		return nil, fmt.Errorf("expected an operator after %s", f.kind)
+	}
+	op := tok.text
+	switch op {
+	case "exists":
+		return comparison{field: f, op: op}, nil
+	case "==", "!=", "prefix", "suffix", "contains", "matches":
+	default:
+		return nil, fmt.Errorf("unknown operator %q - must be ==, !=, prefix, suffix, contains, matches or exists", op)
+	}
+
+	tok, ok = p.next()
+	if !ok || tok.kind == tokenSymbol {
+		return nil, fmt.Errorf("expected a value after %s", op)
+	}
+
+	c := comparison{field: f, op: op, literal: tok.text}
+	if op == "matches" {
+		c.re, err = regexp.Compile(tok.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", tok.text, err)
+		}
+	}
+
+	return c, nil
+}
@@ -0,0 +1,219 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/handler"
+)
+
+// Rule actions
+const (
+	// ActionDrop skips the record
+	ActionDrop = "drop"
+	// ActionHandler passes the record to the named handler instead of the default one
+	ActionHandler = "handler"
+	// ActionForward emits the record, unchanged, to another topic
+	ActionForward = "forward"
+)
+
+// Rule applies its action to the records matching its expression. Rules are written as
+// "<expression> -> <action>", e.g.
+//
+//	header.type == "heartbeat" -> drop
+//	key prefix "test-" || topic == "sandbox" -> drop
+//	value.order.status == "cancelled" && !header.replay.source exists -> handler cancellations
+//	value.region matches "^eu-" -> forward orders-eu
+//
+// Expressions compare the topic, key, header.<name>, value or value.<path> of a record (path
+// being the dot separated path of a JSON field) to a string, quoted or not, with ==, !=, prefix,
+// suffix, contains, matches (a regular expression) or exists, combined with &&, || and !, and
+// grouped with parentheses.
+type Rule struct {
+	Source string
+	Action string
+	// Target is the handler name or topic of the action
+	Target string
+
+	expr expr
+}
+
+// Parse parses a rule
+func Parse(rule string) (Rule, error) {
+	i := strings.LastIndex(rule, "->")
+	if i < 0 {
+		return Rule{}, fmt.Errorf("invalid rule %q: missing -> <action>", rule)
+	}
+
+	e, err := parseExpr(rule[:i])
+	if err != nil {
+		return Rule{}, fmt.Errorf("invalid rule %q: %w", rule, err)
+	}
+
+	action := strings.Fields(rule[i+2:])
+	r := Rule{Source: strings.TrimSpace(rule), expr: e}
+	switch {
+	case len(action) == 1 && action[0] == ActionDrop:
+		r.Action = ActionDrop
+	case len(action) == 2 && (action[0] == ActionHandler || action[0] == ActionForward):
+		r.Action, r.Target = action[0], action[1]
+	default:
+		return Rule{}, fmt.Errorf("invalid rule %q: the action must be drop, handler <name> or forward <topic>", rule)
+	}
+
+	return r, nil
+}
+
+// ParseRules parses rules, skipping blank ones
+func ParseRules(rules []string) ([]Rule, error) {
+	var parsed []Rule
+	var errs []error
+	for _, rule := range rules {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+
+		r, err := Parse(rule)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		parsed = append(parsed, r)
+	}
+
+	return parsed, errors.Join(errs...)
+}
+
+// Match reports whether r matches the rule expression
+func (rule Rule) Match(r *kgo.Record) bool {
+	return rule.expr.eval(&record{Record: r})
+}
+
+// Filter is an expression, written like the expression of a rule, records are matched against
+type Filter struct {
+	Source string
+
+	expr expr
+}
+
+// ParseFilter parses a filter expression
+func ParseFilter(filter string) (Filter, error) {
+	e, err := parseExpr(filter)
+	if err != nil {
+		return Filter{}, fmt.Errorf("invalid filter %q: %w", filter, err)
+	}
+
+	return Filter{Source: strings.TrimSpace(filter), expr: e}, nil
+}
+
+// Match reports whether r matches the filter
+func (f Filter) Match(r *kgo.Record) bool {
+	return f.expr.eval(&record{Record: r})
+}
+
+// Router applies the action of the first rule matching each record, before the handler is called.
+// Records matching no rule go to the default handler.
+type Router struct {
+	rules    []Rule
+	handlers map[string]handler.Handler
+	log      *slog.Logger
+}
+
+// New returns a router applying rules, with handlers the named handlers rules can route to
+func New(rules []Rule, handlers map[string]handler.Handler, log *slog.Logger) (*Router, error) {
+	if err := checkTargets(rules, handlers); err != nil {
+		return nil, err
+	}
+
+	return &Router{rules: rules, handlers: handlers, log: log}, nil
+}
+
+// CheckRules parses rules, and checks the rules routing records to a handler route them to one of
+// handlers, like New does
+func CheckRules(rules []string, handlers map[string]handler.Handler) error {
+	parsed, err := ParseRules(rules)
+	if err != nil {
+		return err
+	}
+
+	return checkTargets(parsed, handlers)
+}
+
+// checkTargets checks the rules routing records to a handler route them to one of handlers
+func checkTargets(rules []Rule, handlers map[string]handler.Handler) error {
+	var errs []error
+	for _, rule := range rules {
+		if _, ok := handlers[rule.Target]; rule.Action == ActionHandler && !ok {
+			errs = append(errs, fmt.Errorf("rule %q routes to unknown handler %q", rule.Source, rule.Target))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// match returns the first rule matching r, if any
+func (rt *Router) match(r *kgo.Record) (Rule, bool) {
+	rec := &record{Record: r}
+	for _, rule := range rt.rules {
+		if rule.expr.eval(rec) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// apply applies the action of rule to r
+func (rt *Router) apply(ctx context.Context, rule Rule, r *kgo.Record) error {
+	rt.log.Debug("record routed", "topic", r.Topic, "partition", r.Partition, "offset", r.Offset, "rule", rule.Source)
+
+	switch rule.Action {
+	case ActionHandler:
+		return rt.handlers[rule.Target].Handle(ctx, r)
+	case ActionForward:
+		forwarded := &kgo.Record{Topic: rule.Target, Key: r.Key, Value: r.Value, Headers: r.Headers, Timestamp: r.Timestamp}
+		return handler.Emit(ctx, forwarded)
+	}
+
+	return nil
+}
+
+// Wrap returns a handler applying the rules, and passing the records matching no rule to next
+func (rt *Router) Wrap(next handler.Handler) handler.Handler {
+	return handler.Func(func(ctx context.Context, r *kgo.Record) error {
+		rule, ok := rt.match(r)
+		if !ok {
+			return next.Handle(ctx, r)
+		}
+		return rt.apply(ctx, rule, r)
+	})
+}
+
+// WrapBatch returns a batch handler applying the rules, and passing the records matching no rule
+// to next in a single batch
+func (rt *Router) WrapBatch(next handler.BatchHandler) handler.BatchHandler {
+	return handler.BatchFunc(func(ctx context.Context, records []*kgo.Record) error {
+		batchErr := &handler.BatchError{}
+		unmatched := make([]*kgo.Record, 0, len(records))
+		for _, r := range records {
+			rule, ok := rt.match(r)
+			if !ok {
+				unmatched = append(unmatched, r)
+				continue
+			}
+			if err := rt.apply(ctx, rule, r); err != nil {
+				batchErr.Fail(r, err)
+			}
+		}
+
+		if len(unmatched) > 0 {
+			batchErr.Failures = append(batchErr.Failures, handler.Failures(unmatched, next.HandleBatch(ctx, unmatched))...)
+		}
+
+		return batchErr.Err()
+	})
+}
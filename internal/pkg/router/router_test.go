@@ -0,0 +1,200 @@
+package router_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/handler"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/router"
+)
+
+func TestMatch(t *testing.T) {
+	r := &kgo.Record{
+		Topic:   "orders",
+		Key:     []byte("test-42"),
+		Value:   []byte(`{"order": {"status": "cancelled", "total": 12.5}, "region": "eu-west-1"}`),
+		Headers: []kgo.RecordHeader{{Key: "type", Value: []byte("order")}, {Key: "dlq.error", Value: []byte("timeout")}},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{expr: `topic == orders`, want: true},
+		{expr: `topic != "orders"`, want: false},
+		{expr: `key prefix "test-"`, want: true},
+		{expr: `key suffix "-41"`, want: false},
+		{expr: `header.type == "order"`, want: true},
+		{expr: `header.trace-id exists`, want: false},
+		{expr: `header.dlq.error contains time`, want: true},
+		{expr: `header.trace-id != "abc"`, want: true},
+		{expr: `value contains "cancelled"`, want: true},
+		{expr: `value.order.status == "cancelled"`, want: true},
+		{expr: `value.order.total == 12.5`, want: true},
+		{expr: `value.order.missing exists`, want: false},
+		{expr: `value.region matches "^eu-"`, want: true},
+		{expr: `topic == payments || key prefix "test-" && header.type == order`, want: true},
+		{expr: `(topic == payments || key prefix "test-") && header.type == invoice`, want: false},
+		{expr: `!value.order.status == "shipped"`, want: true},
+		{expr: `value.order == "{\"status\":\"cancelled\",\"total\":12.5}"`, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			rule, err := router.Parse(tt.expr + " -> drop")
+			if err != nil {
+				t.Fatalf("unexpected parse error: %v", err)
+			}
+			if got := rule.Match(r); got != tt.want {
+				t.Fatalf("expected match %t but got %t", tt.want, got)
+			}
+
+			filter, err := router.ParseFilter(tt.expr)
+			if err != nil {
+				t.Fatalf("unexpected filter parse error: %v", err)
+			}
+			if got := filter.Match(r); got != tt.want {
+				t.Fatalf("expected filter match %t but got %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		rule    string
+		action  string
+		target  string
+		wantErr bool
+	}{
+		{rule: `header.type == heartbeat -> drop`, action: router.ActionDrop},
+		{rule: `value.region matches "^eu-" -> forward orders-eu`, action: router.ActionForward, target: "orders-eu"},
+		{rule: `key prefix "a->b" -> handler cancellations`, action: router.ActionHandler, target: "cancellations"},
+		{rule: `header.type == heartbeat`, wantErr: true},
+		{rule: `header.type == heartbeat -> delete`, wantErr: true},
+		{rule: `header.type == heartbeat -> forward`, wantErr: true},
+		{rule: `partition == 1 -> drop`, wantErr: true},
+		{rule: `key startsWith a -> drop`, wantErr: true},
+		{rule: `key == -> drop`, wantErr: true},
+		{rule: `(key == a -> drop`, wantErr: true},
+		{rule: `key == "a -> drop`, wantErr: true},
+		{rule: `key matches "(" -> drop`, wantErr: true},
+		{rule: ` -> drop`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			rule, err := router.Parse(tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %t but got: %v", tt.wantErr, err)
+			}
+			if rule.Action != tt.action || rule.Target != tt.target {
+				t.Fatalf("expected action %q %q but got %q %q", tt.action, tt.target, rule.Action, rule.Target)
+			}
+		})
+	}
+}
+
+func TestCheckRules(t *testing.T) {
+	handlers := map[string]handler.Handler{"cancellations": handler.Func(func(context.Context, *kgo.Record) error { return nil })}
+
+	tests := []struct {
+		name    string
+		rules   []string
+		wantErr bool
+	}{
+		{name: "valid", rules: []string{`header.type == heartbeat -> drop`, `value.status == cancelled -> handler cancellations`}},
+		{name: "no rules"},
+		{name: "invalid rule", rules: []string{`header.type == heartbeat -> drop`, `key startsWith test -> drop`}, wantErr: true},
+		{name: "unknown handler", rules: []string{`value.status == refunded -> handler refunds`}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := router.CheckRules(tt.rules, handlers)
+			if tt.wantErr && err == nil {
+				t.Fatal("expected an error but got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+type testEmitter struct {
+	records []*kgo.Record
+}
+
+func (e *testEmitter) Emit(_ context.Context, r *kgo.Record) error {
+	e.records = append(e.records, r)
+	return nil
+}
+
+func TestRouter(t *testing.T) {
+	rules, err := router.ParseRules([]string{
+		`header.type == heartbeat -> drop`,
+		"",
+		`value.status == cancelled -> handler cancellations`,
+		`value.region matches "^eu-" -> forward orders-eu`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+
+	var handled []string
+	recordTo := func(name string) handler.Handler {
+		return handler.Func(func(_ context.Context, r *kgo.Record) error {
+			handled = append(handled, name+":"+string(r.Key))
+			return nil
+		})
+	}
+
+	_, err = router.New(rules, nil, slog.New(slog.DiscardHandler))
+	if err == nil {
+		t.Fatal("expected an unknown handler error but got nil")
+	}
+
+	rt, err := router.New(rules, map[string]handler.Handler{"cancellations": recordTo("cancellations")}, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("unexpected router error: %v", err)
+	}
+
+	emitter := &testEmitter{}
+	ctx := handler.WithEmitter(context.Background(), emitter)
+	records := []*kgo.Record{
+		{Topic: "orders", Key: []byte("1"), Headers: []kgo.RecordHeader{{Key: "type", Value: []byte("heartbeat")}}},
+		{Topic: "orders", Key: []byte("2"), Value: []byte(`{"status": "cancelled"}`)},
+		{Topic: "orders", Key: []byte("3"), Value: []byte(`{"region": "eu-west-1"}`)},
+		{Topic: "orders", Key: []byte("4"), Value: []byte(`{"region": "us-east-1"}`)},
+	}
+
+	h := rt.Wrap(recordTo("default"))
+	for _, r := range records {
+		if err := h.Handle(ctx, r); err != nil {
+			t.Fatalf("unexpected handler error: %v", err)
+		}
+	}
+
+	err = rt.WrapBatch(handler.PerRecord(recordTo("batch"))).HandleBatch(ctx, records)
+	if err != nil {
+		t.Fatalf("unexpected batch handler error: %v", err)
+	}
+
+	want := []string{"cancellations:2", "default:4", "cancellations:2", "batch:4"}
+	if len(handled) != len(want) {
+		t.Fatalf("expected %v to be handled but got %v", want, handled)
+	}
+	for i := range want {
+		if handled[i] != want[i] {
+			t.Fatalf("expected %v to be handled but got %v", want, handled)
+		}
+	}
+
+	if len(emitter.records) != 2 || emitter.records[0].Topic != "orders-eu" || string(emitter.records[0].Key) != "3" {
+		t.Fatalf("expected record 3 to be forwarded to orders-eu twice but got %v", emitter.records)
+	}
+}
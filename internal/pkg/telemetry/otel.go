@@ -13,6 +13,7 @@ import (
 	"go.opentelemetry.io/otel/sdk/trace"
 
 	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+	"github.com/rodney-b/swish-test-consumer/internal/pkg/logger"
 	"github.com/rodney-b/swish-test-consumer/pkg/certs"
 )
 
@@ -81,7 +82,8 @@ func newMeterProvider(ctx context.Context, cp config.ConfigProvider) (*metric.Me
 		exporter, err = stdoutmetric.New()
 	} else {
 		// TODO: Replace data source issuer with a dedicated issuer or use otel collector issuer
-		tlsConfig, err := certs.CreateTLSConfig(cp.GetConsumerCA(), cp.GetConsumerCert(), cp.GetConsumerCertKey())
+		var certSource *certs.Reloader
+		certSource, err = newCertReloader(cp)
 		if err != nil {
 			return nil, err
 		}
@@ -89,7 +91,7 @@ func newMeterProvider(ctx context.Context, cp config.ConfigProvider) (*metric.Me
 		exporter, err = otlpmetrichttp.New(
 			ctx,
 			otlpmetrichttp.WithEndpoint(cp.GetOTelHTTPReceiverURL()),
-			otlpmetrichttp.WithTLSClientConfig(tlsConfig),
+			otlpmetrichttp.WithTLSClientConfig(certSource.TLSConfig()),
 		)
 	}
 	if err != nil {
@@ -103,6 +105,44 @@ func newMeterProvider(ctx context.Context, cp config.ConfigProvider) (*metric.Me
 	return meterProvider, nil
 }
 
+// newCertReloader returns a certificate source following the OTel TLS policy, that's reloaded
+// when the consumer certificates are rotated
+func newCertReloader(cp config.ConfigProvider) (*certs.Reloader, error) {
+	opts, err := cp.GetOTelTLSPolicy().CertOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	certSource, err := certs.NewReloader(func() certs.Material {
+		return certs.Material{
+			CACertPEM:     cp.GetConsumerCA(),
+			ClientCertPEM: cp.GetConsumerCert(),
+			ClientKeyPEM:  cp.GetConsumerCertKey(),
+			Password:      cp.GetConsumerCertKeyPassword(),
+		}
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	log := logger.New("telemetry")
+	cp.Subscribe(func(_ config.ConfigProvider, change config.Change) {
+		if !change.Has("CONSUMER_CA") && !change.Has("CONSUMER_CRT") && !change.Has("CONSUMER_KEY") &&
+			!change.Has("CONSUMER_KEY_PASSWORD") {
+			return
+		}
+
+		err := certSource.Reload()
+		if err != nil {
+			log.Error("error reloading consumer certificates", "error", err.Error())
+			return
+		}
+		log.Info("consumer certificates reloaded")
+	})
+
+	return certSource, nil
+}
+
 func newTracerProvider(ctx context.Context, cp config.ConfigProvider) (*trace.TracerProvider, error) {
 	traceExporter, err := otlptracehttp.New(
 		ctx,
@@ -3,12 +3,15 @@ package telemetry
 import (
 	"context"
 	"log/slog"
+	"time"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 
 	"github.com/rodney-b/swish-test-consumer/internal/pkg/config"
+	"github.com/rodney-b/swish-test-consumer/pkg/certs"
 )
 
 type Telemetry struct {
@@ -19,7 +22,11 @@ type Telemetry struct {
 }
 
 var (
-	messageCounter metric.Int64Counter
+	messageCounter         metric.Int64Counter
+	failureCounter         metric.Int64Counter
+	certificateExpiryGauge metric.Float64Gauge
+	consumedTopicsGauge    metric.Int64Gauge
+	topicChangeCounter     metric.Int64Counter
 )
 
 func NewTelemetry(ctx context.Context, cp config.ConfigProvider, logger *slog.Logger) (*Telemetry, error) {
@@ -66,9 +73,80 @@ func initMeterInstruments(meter metric.Meter) error {
 		return err
 	}
 
+	failureCounter, err = meter.Int64Counter(
+		"consumed.failed",
+		metric.WithDescription("count of messages that failed to be handled"),
+	)
+	if err != nil {
+		return err
+	}
+
+	certificateExpiryGauge, err = meter.Float64Gauge(
+		"certificate.days_until_expiry",
+		metric.WithDescription("days left before a certificate expires, negative once expired"),
+		metric.WithUnit("d"),
+	)
+	if err != nil {
+		return err
+	}
+
+	consumedTopicsGauge, err = meter.Int64Gauge(
+		"consumed.topics",
+		metric.WithDescription("number of topics consumed"),
+	)
+	if err != nil {
+		return err
+	}
+
+	topicChangeCounter, err = meter.Int64Counter(
+		"consumed.topic_changes",
+		metric.WithDescription("count of topics added to and removed from the consumed topics"),
+	)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func (tel *Telemetry) IncrementMessageCounter(ctx context.Context, cp config.ConfigProvider) {
 	messageCounter.Add(ctx, 1, metric.WithAttributes())
 }
+
+// IncrementFailureCounter counts a message of topic that failed to be handled, and what happened
+// to it: "retried", "dead_lettered" or "skipped"
+func (tel *Telemetry) IncrementFailureCounter(ctx context.Context, topic string, outcome string) {
+	failureCounter.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("topic", topic),
+		attribute.String("outcome", outcome),
+	))
+}
+
+// RecordCertificateExpiry records the days left before the certificate expires.
+// name identifies where the certificate is used e.g. "message-queue-client". The serial number
+// isn't recorded, so rotating a certificate doesn't add a series.
+func (tel *Telemetry) RecordCertificateExpiry(ctx context.Context, name string, info certs.CertInfo) {
+	certificateExpiryGauge.Record(ctx, info.UntilExpiry(time.Now()).Hours()/24, metric.WithAttributes(
+		attribute.String("certificate.name", name),
+		attribute.String("certificate.subject", info.Subject),
+		attribute.Bool("certificate.leaf", info.Leaf),
+	))
+}
+
+// RecordTopicChanges records the number of topics consumed and counts the topics added and removed
+func (tel *Telemetry) RecordTopicChanges(ctx context.Context, consumed, added, removed []string) {
+	consumedTopicsGauge.Record(ctx, int64(len(consumed)))
+
+	for _, topic := range added {
+		topicChangeCounter.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("topic", topic),
+			attribute.String("change", "added"),
+		))
+	}
+	for _, topic := range removed {
+		topicChangeCounter.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("topic", topic),
+			attribute.String("change", "removed"),
+		))
+	}
+}
@@ -2,32 +2,35 @@ package certs
 
 import (
 	"crypto/tls"
-	"crypto/x509"
-	"errors"
 	"fmt"
 )
 
 var (
 	ErrCaCertAppendFail       = fmt.Errorf("failed to append server CA certificate")
 	ErrParseClientKeyPairFail = fmt.Errorf("failed to parse client:key pair")
+	ErrIncompleteClientPair   = fmt.Errorf("client certificate and key must be provided together")
 )
 
+// CreateTLSConfig returns a client TLS config using the default TLS policy
 func CreateTLSConfig(caCertPEM, clientCertPEM, clientKeyPEM []byte) (*tls.Config, error) {
-	caCertPool := x509.NewCertPool()
-	if ok := caCertPool.AppendCertsFromPEM(caCertPEM); !ok {
-		return nil, ErrCaCertAppendFail
-	}
+	return NewTLSConfig(caCertPEM, clientCertPEM, clientKeyPEM)
+}
 
-	clientCert, err := tls.X509KeyPair(clientCertPEM, clientKeyPEM)
-	if err != nil {
-		return nil, errors.Join(ErrParseClientKeyPairFail, err)
-	}
+// NewTLSConfig returns a client TLS config following the policy set by opts.
+// The client certificate and key are optional, without them only the server is authenticated.
+// The CA is only optional if the system roots are trusted (see WithSystemRoots).
+func NewTLSConfig(caCertPEM, clientCertPEM, clientKeyPEM []byte, opts ...Option) (*tls.Config, error) {
+	return NewTLSConfigFromMaterial(PEMs(caCertPEM, clientCertPEM, clientKeyPEM), opts...)
+}
 
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{clientCert},
-		RootCAs:      caCertPool,
-		MinVersion:   tls.VersionTLS12, // Optional: enforce minimum TLS version
+// NewTLSConfigFromMaterial is NewTLSConfig for encrypted keys and PKCS#12 keystores
+func NewTLSConfigFromMaterial(material Material, opts ...Option) (*tls.Config, error) {
+	r, err := NewReloader(func() Material {
+		return material
+	}, opts...)
+	if err != nil {
+		return nil, err
 	}
 
-	return tlsConfig, nil
+	return r.TLSConfig(), nil
 }
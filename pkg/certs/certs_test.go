@@ -0,0 +1,551 @@
+package certs_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/rodney-b/swish-test-consumer/pkg/certs"
+)
+
+type testPKI struct {
+	caCert  *x509.Certificate
+	caKey   *ecdsa.PrivateKey
+	caPEM   []byte
+	serial  int64
+	subject string
+}
+
+func newTestPKI(t *testing.T, name string) *testPKI {
+	t.Helper()
+
+	pki := &testPKI{subject: name}
+	pki.caKey = generateKey(t)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name + "-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &pki.caKey.PublicKey, pki.caKey)
+	if err != nil {
+		t.Fatalf("error creating CA certificate: %v", err)
+	}
+
+	pki.caCert, err = x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("error parsing CA certificate: %v", err)
+	}
+	pki.caPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	pki.serial = 1
+
+	return pki
+}
+
+// issue returns a certificate and key PEM signed by the PKI's CA
+func (pki *testPKI) issue(t *testing.T, commonName string, notAfter time.Time) (certPEM, keyPEM []byte) {
+	t.Helper()
+
+	pki.serial++
+	key := generateKey(t)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(pki.serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, pki.caCert, &key.PublicKey, pki.caKey)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("error marshalling key: %v", err)
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM
+}
+
+func generateKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+
+	return key
+}
+
+// newMTLSServer starts a server requiring client certificates signed by clientPKI, or not asking
+// for client certificates if clientPKI is nil. It returns a channel receiving the common name of
+// every client certificate it sees.
+func newMTLSServer(t *testing.T, serverPKI, clientPKI *testPKI) (*httptest.Server, <-chan string) {
+	t.Helper()
+
+	clientNames := make(chan string, 10)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			clientNames <- r.TLS.PeerCertificates[0].Subject.CommonName
+		}
+	}))
+
+	certPEM, keyPEM := serverPKI.issue(t, "server", time.Now().Add(time.Hour))
+	serverCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("error parsing server key pair: %v", err)
+	}
+
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+	}
+	if clientPKI != nil {
+		server.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+		server.TLS.ClientCAs = x509.NewCertPool()
+		server.TLS.ClientCAs.AddCert(clientPKI.caCert)
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return server, clientNames
+}
+
+func TestReloader(t *testing.T) {
+	serverPKI := newTestPKI(t, "server")
+	otherServerPKI := newTestPKI(t, "other-server")
+	clientPKI := newTestPKI(t, "client")
+	server, clientNames := newMTLSServer(t, serverPKI, clientPKI)
+
+	var mu sync.Mutex
+	caPEM := serverPKI.caPEM
+	certPEM, keyPEM := clientPKI.issue(t, "client-1", time.Now().Add(time.Hour))
+
+	reloader, err := certs.NewReloader(func() certs.Material {
+		mu.Lock()
+		defer mu.Unlock()
+		return certs.PEMs(caPEM, certPEM, keyPEM)
+	})
+	if err != nil {
+		t.Fatalf("error creating reloader: %v", err)
+	}
+
+	request := func() error {
+		// new transport for every request so each one does a handshake
+		client := http.Client{Transport: &http.Transport{TLSClientConfig: reloader.TLSConfig()}}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	if err := request(); err != nil {
+		t.Fatalf("request with the initial certificates failed: %v", err)
+	}
+	if name := <-clientNames; name != "client-1" {
+		t.Fatalf("expected client certificate client-1 but server got %s", name)
+	}
+
+	// rotated client certificate
+	mu.Lock()
+	certPEM, keyPEM = clientPKI.issue(t, "client-2", time.Now().Add(time.Hour))
+	mu.Unlock()
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("error reloading: %v", err)
+	}
+
+	if err := request(); err != nil {
+		t.Fatalf("request with the rotated certificate failed: %v", err)
+	}
+	if name := <-clientNames; name != "client-2" {
+		t.Fatalf("expected client certificate client-2 but server got %s", name)
+	}
+
+	// invalid material is rejected and the current material kept
+	mu.Lock()
+	keyPEM = []byte("not a key")
+	mu.Unlock()
+	if err := reloader.Reload(); err == nil {
+		t.Fatal("expected an error reloading an invalid key but got nil")
+	}
+	if err := request(); err != nil {
+		t.Fatalf("request after a failed reload failed: %v", err)
+	}
+	<-clientNames
+
+	// the server's certificate is no longer trusted once the CA changes
+	mu.Lock()
+	caPEM = otherServerPKI.caPEM
+	certPEM, keyPEM = clientPKI.issue(t, "client-3", time.Now().Add(time.Hour))
+	mu.Unlock()
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("error reloading: %v", err)
+	}
+	if err := request(); err == nil {
+		t.Fatal("expected the server certificate to be rejected after the CA changed")
+	}
+}
+
+func TestInspect(t *testing.T) {
+	pki := newTestPKI(t, "inspect")
+	notAfter := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	certPEM, keyPEM := pki.issue(t, "leaf", notAfter)
+
+	// leaf followed by its chain, with the key mixed in
+	chainPEM := append(append(append([]byte{}, certPEM...), keyPEM...), pki.caPEM...)
+	infos, err := certs.Inspect(chainPEM)
+	if err != nil {
+		t.Fatalf("error inspecting certificates: %v", err)
+	}
+
+	if len(infos) != 2 {
+		t.Fatalf("expected 2 certificates but got %d", len(infos))
+	}
+	if !infos[0].Leaf || infos[1].Leaf {
+		t.Fatalf("expected only the first certificate to be the leaf: %+v", infos)
+	}
+	if infos[0].Subject != "CN=leaf" || infos[0].Issuer != "CN=inspect-ca" {
+		t.Fatalf("unexpected leaf subject/issuer: %+v", infos[0])
+	}
+	if !infos[0].NotAfter.Equal(notAfter) {
+		t.Fatalf("expected leaf to expire at %v but got %v", notAfter, infos[0].NotAfter)
+	}
+
+	now := time.Now()
+	if days := infos[0].UntilExpiry(now).Hours() / 24; days < 1.9 || days > 2 {
+		t.Fatalf("expected about 2 days until expiry but got %f", days)
+	}
+	if infos[0].Expired(now) || !infos[0].Expired(notAfter.Add(time.Second)) {
+		t.Fatal("unexpected expiry status")
+	}
+
+	_, err = certs.Inspect(keyPEM)
+	if err == nil {
+		t.Fatal("expected an error inspecting PEM data without certificates")
+	}
+}
+
+func TestInspectPKCS12(t *testing.T) {
+	pki := newTestPKI(t, "inspect")
+	notAfter := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	certPEM, keyPEM := pki.issue(t, "p12-leaf", notAfter)
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("error parsing key pair: %v", err)
+	}
+	keystore, err := pkcs12.Modern.Encode(pair.PrivateKey, pair.Leaf, []*x509.Certificate{pki.caCert}, "changeit")
+	if err != nil {
+		t.Fatalf("error encoding keystore: %v", err)
+	}
+
+	infos, err := certs.InspectPKCS12(keystore, "changeit")
+	if err != nil {
+		t.Fatalf("error inspecting keystore: %v", err)
+	}
+
+	if len(infos) != 2 {
+		t.Fatalf("expected 2 certificates but got %d", len(infos))
+	}
+	if !infos[0].Leaf || infos[0].Subject != "CN=p12-leaf" || !infos[0].NotAfter.Equal(notAfter) {
+		t.Fatalf("unexpected leaf: %+v", infos[0])
+	}
+	if infos[1].Leaf || infos[1].Subject != "CN=inspect-ca" {
+		t.Fatalf("unexpected chain certificate: %+v", infos[1])
+	}
+
+	if _, err := certs.InspectPKCS12(keystore, "wrong"); !errors.Is(err, certs.ErrParsePKCS12Fail) {
+		t.Fatalf("expected ErrParsePKCS12Fail with a wrong password but got %v", err)
+	}
+}
+
+func TestNewTLSConfigPolicy(t *testing.T) {
+	serverPKI := newTestPKI(t, "server")
+	otherPKI := newTestPKI(t, "other")
+	clientPKI := newTestPKI(t, "client")
+	mtlsServer, _ := newMTLSServer(t, serverPKI, clientPKI)
+	tlsServer, _ := newMTLSServer(t, serverPKI, nil)
+	clientCertPEM, clientKeyPEM := clientPKI.issue(t, "client", time.Now().Add(time.Hour))
+
+	serverSPKI := sha256.Sum256(tlsServer.Certificate().RawSubjectPublicKeyInfo)
+	serverPin := base64.StdEncoding.EncodeToString(serverSPKI[:])
+	otherPin := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	tests := []struct {
+		name      string
+		serverURL string
+		caPEM     []byte
+		certPEM   []byte
+		keyPEM    []byte
+		opts      []certs.Option
+		wantErr   bool
+	}{
+		{name: "mutual TLS", serverURL: mtlsServer.URL, caPEM: serverPKI.caPEM, certPEM: clientCertPEM, keyPEM: clientKeyPEM},
+		{name: "missing client certificate", serverURL: mtlsServer.URL, caPEM: serverPKI.caPEM, wantErr: true},
+		{name: "server authentication only", serverURL: tlsServer.URL, caPEM: serverPKI.caPEM},
+		{name: "untrusted server", serverURL: tlsServer.URL, caPEM: otherPKI.caPEM, wantErr: true},
+		{name: "system roots plus extra CA", serverURL: tlsServer.URL, caPEM: serverPKI.caPEM, opts: []certs.Option{certs.WithSystemRoots()}},
+		{name: "matching SPKI pin", serverURL: tlsServer.URL, caPEM: serverPKI.caPEM, opts: []certs.Option{certs.WithSPKIPins(otherPin, serverPin)}},
+		{name: "mismatched SPKI pin", serverURL: tlsServer.URL, caPEM: serverPKI.caPEM, opts: []certs.Option{certs.WithSPKIPins(otherPin)}, wantErr: true},
+		{name: "insecure skip verify", serverURL: tlsServer.URL, caPEM: otherPKI.caPEM, opts: []certs.Option{certs.WithInsecureSkipVerify()}},
+		{name: "server name mismatch", serverURL: tlsServer.URL, caPEM: serverPKI.caPEM, opts: []certs.Option{certs.WithServerName("kafka.example.com")}, wantErr: true},
+		{name: "server name override", serverURL: tlsServer.URL, caPEM: serverPKI.caPEM, opts: []certs.Option{certs.WithServerName("localhost")}},
+		{name: "max version below server", serverURL: tlsServer.URL, caPEM: serverPKI.caPEM, opts: []certs.Option{certs.WithMinVersion(tls.VersionTLS10), certs.WithMaxVersion(tls.VersionTLS11)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := certs.NewTLSConfig(tt.caPEM, tt.certPEM, tt.keyPEM, tt.opts...)
+			if err != nil {
+				t.Fatalf("error creating TLS config: %v", err)
+			}
+
+			client := http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+			resp, err := client.Get(tt.serverURL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("request error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestSPKIPinsAppendedCertificate checks pins can't be matched by certificates the server appends
+// to its chain without them being part of a verified chain
+func TestSPKIPinsAppendedCertificate(t *testing.T) {
+	serverPKI := newTestPKI(t, "server")
+	pinnedPKI := newTestPKI(t, "pinned")
+
+	certPEM, keyPEM := serverPKI.issue(t, "server", time.Now().Add(time.Hour))
+	serverCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("error parsing server key pair: %v", err)
+	}
+	// the pinned CA certificate is presented but doesn't sign the server's certificate
+	serverCert.Certificate = append(serverCert.Certificate, pinnedPKI.caCert.Raw)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	pin := func(cert *x509.Certificate) string {
+		spki := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		return base64.StdEncoding.EncodeToString(spki[:])
+	}
+
+	tests := []struct {
+		name    string
+		opts    []certs.Option
+		wantErr bool
+	}{
+		{name: "appended pinned certificate", opts: []certs.Option{certs.WithSPKIPins(pin(pinnedPKI.caCert))}, wantErr: true},
+		{name: "appended pinned certificate without verification", opts: []certs.Option{certs.WithSPKIPins(pin(pinnedPKI.caCert)), certs.WithInsecureSkipVerify()}, wantErr: true},
+		{name: "pinned CA of the verified chain", opts: []certs.Option{certs.WithSPKIPins(pin(serverPKI.caCert))}},
+		{name: "pinned CA without verification", opts: []certs.Option{certs.WithSPKIPins(pin(serverPKI.caCert)), certs.WithInsecureSkipVerify()}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := certs.NewTLSConfig(serverPKI.caPEM, nil, nil, tt.opts...)
+			if err != nil {
+				t.Fatalf("error creating TLS config: %v", err)
+			}
+
+			client := http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+			resp, err := client.Get(server.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("request error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewTLSConfigInvalid(t *testing.T) {
+	pki := newTestPKI(t, "invalid")
+	certPEM, _ := pki.issue(t, "client", time.Now().Add(time.Hour))
+
+	if _, err := certs.NewTLSConfig(nil, nil, nil); !errors.Is(err, certs.ErrCaCertAppendFail) {
+		t.Fatalf("expected ErrCaCertAppendFail without a CA but got %v", err)
+	}
+	if _, err := certs.NewTLSConfig(pki.caPEM, certPEM, nil); !errors.Is(err, certs.ErrIncompleteClientPair) {
+		t.Fatalf("expected ErrIncompleteClientPair without a key but got %v", err)
+	}
+	if _, err := certs.NewTLSConfig(pki.caPEM, nil, nil, certs.WithSPKIPins("too-short")); err == nil {
+		t.Fatal("expected an invalid SPKI pin error but got nil")
+	}
+	if _, err := certs.ParseCipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"}); err == nil {
+		t.Fatal("expected insecure cipher suites to be rejected")
+	}
+}
+
+// clientCertificate returns the client certificate served by tlsConfig
+func clientCertificate(t *testing.T, tlsConfig *tls.Config) *tls.Certificate {
+	t.Helper()
+
+	clientCert, err := tlsConfig.GetClientCertificate(&tls.CertificateRequestInfo{})
+	if err != nil {
+		t.Fatalf("error getting client certificate: %v", err)
+	}
+	if len(clientCert.Certificate) == 0 {
+		t.Fatal("expected a client certificate but got none")
+	}
+
+	return clientCert
+}
+
+func TestNewTLSConfigEncryptedKey(t *testing.T) {
+	pki := newTestPKI(t, "encrypted")
+	certPEM, err := os.ReadFile("testdata/client.crt")
+	if err != nil {
+		t.Fatalf("error reading certificate: %v", err)
+	}
+
+	_, plainKeyPEM := pki.issue(t, "legacy", time.Now().Add(time.Hour))
+	legacyCertPEM, legacyKeyPEM := pki.issue(t, "legacy", time.Now().Add(time.Hour))
+	block, _ := pem.Decode(legacyKeyPEM)
+	//nolint:staticcheck // legacy PEM encryption is what's being tested
+	legacyBlock, err := x509.EncryptPEMBlock(rand.Reader, "PRIVATE KEY", block.Bytes, []byte("changeit"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatalf("error encrypting legacy key: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		certPEM  []byte
+		keyFile  string
+		keyPEM   []byte
+		password string
+		err      error
+	}{
+		{name: "PKCS#8 AES-256-CBC", certPEM: certPEM, keyFile: "client-aes256.key", password: "changeit"},
+		{name: "PKCS#8 3DES-CBC", certPEM: certPEM, keyFile: "client-des3.key", password: "changeit"},
+		{name: "legacy PEM encryption", certPEM: legacyCertPEM, keyPEM: pem.EncodeToMemory(legacyBlock), password: "changeit"},
+		{name: "wrong password", certPEM: certPEM, keyFile: "client-aes256.key", password: "wrong", err: certs.ErrIncorrectKeyPassword},
+		{name: "wrong legacy password", certPEM: legacyCertPEM, keyPEM: pem.EncodeToMemory(legacyBlock), password: "wrong", err: certs.ErrIncorrectKeyPassword},
+		{name: "missing password", certPEM: certPEM, keyFile: "client-aes256.key", err: certs.ErrKeyPasswordRequired},
+		{name: "password with a plain key", certPEM: legacyCertPEM, keyPEM: legacyKeyPEM, password: "unused"},
+		{name: "mismatched plain key", certPEM: certPEM, keyPEM: plainKeyPEM, err: certs.ErrParseClientKeyPairFail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyPEM := tt.keyPEM
+			if tt.keyFile != "" {
+				keyPEM, err = os.ReadFile("testdata/" + tt.keyFile)
+				if err != nil {
+					t.Fatalf("error reading key: %v", err)
+				}
+			}
+
+			tlsConfig, err := certs.NewTLSConfigFromMaterial(certs.Material{
+				CACertPEM:     pki.caPEM,
+				ClientCertPEM: tt.certPEM,
+				ClientKeyPEM:  keyPEM,
+				Password:      tt.password,
+			})
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("expected %v but got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error creating TLS config: %v", err)
+			}
+
+			clientCert := clientCertificate(t, tlsConfig)
+			if !bytes.Equal(clientCert.Certificate[0], mustDecodePEM(t, tt.certPEM)) {
+				t.Fatal("served client certificate doesn't match the configured one")
+			}
+		})
+	}
+}
+
+func TestNewTLSConfigPKCS12(t *testing.T) {
+	serverPKI := newTestPKI(t, "server")
+	clientPKI := newTestPKI(t, "client")
+	server, clientNames := newMTLSServer(t, serverPKI, clientPKI)
+
+	certPEM, keyPEM := clientPKI.issue(t, "p12-client", time.Now().Add(time.Hour))
+	clientPair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("error parsing client key pair: %v", err)
+	}
+	keystore, err := pkcs12.Modern.Encode(clientPair.PrivateKey, clientPair.Leaf, []*x509.Certificate{clientPKI.caCert}, "changeit")
+	if err != nil {
+		t.Fatalf("error encoding keystore: %v", err)
+	}
+
+	if _, err := certs.NewTLSConfigFromMaterial(certs.Material{
+		CACertPEM: serverPKI.caPEM,
+		PKCS12:    keystore,
+		Password:  "wrong",
+	}); !errors.Is(err, certs.ErrParsePKCS12Fail) {
+		t.Fatalf("expected ErrParsePKCS12Fail with a wrong password but got %v", err)
+	}
+
+	tlsConfig, err := certs.NewTLSConfigFromMaterial(certs.Material{
+		CACertPEM: serverPKI.caPEM,
+		PKCS12:    keystore,
+		Password:  "changeit",
+	})
+	if err != nil {
+		t.Fatalf("error creating TLS config: %v", err)
+	}
+	if chain := clientCertificate(t, tlsConfig).Certificate; len(chain) != 2 {
+		t.Fatalf("expected the keystore CA to be sent with the client certificate but got a chain of %d", len(chain))
+	}
+
+	client := http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with the keystore failed: %v", err)
+	}
+	resp.Body.Close()
+	if name := <-clientNames; name != "p12-client" {
+		t.Fatalf("expected client certificate p12-client but server got %s", name)
+	}
+}
+
+func mustDecodePEM(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatal("no PEM data found")
+	}
+
+	return block.Bytes
+}
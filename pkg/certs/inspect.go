@@ -0,0 +1,92 @@
+package certs
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+var (
+	ErrNoCertificatesFound = errors.New("no certificates found in PEM data")
+)
+
+// CertInfo describes a certificate found in PEM data
+type CertInfo struct {
+	Subject      string
+	Issuer       string
+	SerialNumber string
+	NotBefore    time.Time
+	NotAfter     time.Time
+	// Leaf is true for the first certificate in the PEM data, or the client certificate of a
+	// keystore, the rest are assumed to be its chain
+	Leaf bool
+}
+
+// UntilExpiry returns the time left before the certificate expires, negative once it has expired
+func (ci CertInfo) UntilExpiry(now time.Time) time.Duration {
+	return ci.NotAfter.Sub(now)
+}
+
+// Expired reports whether the certificate has expired at now
+func (ci CertInfo) Expired(now time.Time) bool {
+	return !now.Before(ci.NotAfter)
+}
+
+// Inspect parses every certificate in certPEM, in order. Blocks other than certificates are ignored.
+func Inspect(certPEM []byte) ([]CertInfo, error) {
+	var infos []CertInfo
+
+	for rest := certPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		infos = append(infos, newCertInfo(cert, len(infos) == 0))
+	}
+
+	if len(infos) == 0 {
+		return nil, ErrNoCertificatesFound
+	}
+
+	return infos, nil
+}
+
+// InspectPKCS12 parses the client certificate of the keystore data, decrypted with password,
+// followed by its chain
+func InspectPKCS12(data []byte, password string) ([]CertInfo, error) {
+	_, cert, caCerts, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, errors.Join(ErrParsePKCS12Fail, err)
+	}
+
+	infos := []CertInfo{newCertInfo(cert, true)}
+	for _, caCert := range caCerts {
+		infos = append(infos, newCertInfo(caCert, false))
+	}
+
+	return infos, nil
+}
+
+func newCertInfo(cert *x509.Certificate, leaf bool) CertInfo {
+	return CertInfo{
+		Subject:      cert.Subject.String(),
+		Issuer:       cert.Issuer.String(),
+		SerialNumber: cert.SerialNumber.String(),
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+		Leaf:         leaf,
+	}
+}
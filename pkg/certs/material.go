@@ -0,0 +1,151 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+var (
+	ErrKeyPasswordRequired = errors.New("private key is encrypted but no password was provided")
+	ErrParsePKCS12Fail     = errors.New("failed to parse PKCS#12 keystore")
+)
+
+// Material holds the certificates and key used to create a TLS config
+type Material struct {
+	CACertPEM     []byte
+	ClientCertPEM []byte
+	// ClientKeyPEM can be a plain key, an encrypted PKCS#8 key ("ENCRYPTED PRIVATE KEY")
+	// or a legacy encrypted PEM key ("Proc-Type: 4,ENCRYPTED"), decrypted with Password
+	ClientKeyPEM []byte
+	// PKCS12 is a keystore holding the client certificate and key (e.g. the user.p12 of a Strimzi
+	// KafkaUser secret), decrypted with Password. It takes the place of the client PEMs when set.
+	PKCS12   []byte
+	Password string
+}
+
+// MaterialLoader returns the current TLS material
+type MaterialLoader func() Material
+
+// PEMs returns the material made of the CA, client certificate and unencrypted client key PEMs
+func PEMs(caCertPEM, clientCertPEM, clientKeyPEM []byte) Material {
+	return Material{
+		CACertPEM:     caCertPEM,
+		ClientCertPEM: clientCertPEM,
+		ClientKeyPEM:  clientKeyPEM,
+	}
+}
+
+// parse returns the CA pool and client certificate, if any, following the policy o
+func (m Material) parse(o *options) (*x509.CertPool, *tls.Certificate, error) {
+	caCertPool := x509.NewCertPool()
+	if o.systemRoots {
+		systemPool, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, nil, errors.Join(errors.New("failed to load the system root CAs"), err)
+		}
+		caCertPool = systemPool
+	}
+
+	if len(m.CACertPEM) > 0 || !o.systemRoots {
+		if ok := caCertPool.AppendCertsFromPEM(m.CACertPEM); !ok {
+			return nil, nil, ErrCaCertAppendFail
+		}
+	}
+
+	if len(m.PKCS12) > 0 {
+		clientCert, err := parsePKCS12(m.PKCS12, m.Password)
+		if err != nil {
+			return nil, nil, err
+		}
+		return caCertPool, clientCert, nil
+	}
+
+	// server authentication only
+	if len(m.ClientCertPEM) == 0 && len(m.ClientKeyPEM) == 0 {
+		return caCertPool, nil, nil
+	}
+	if len(m.ClientCertPEM) == 0 || len(m.ClientKeyPEM) == 0 {
+		return nil, nil, ErrIncompleteClientPair
+	}
+
+	clientKeyPEM, err := DecryptKeyPEM(m.ClientKeyPEM, m.Password)
+	if err != nil {
+		return nil, nil, errors.Join(ErrParseClientKeyPairFail, err)
+	}
+
+	clientCert, err := tls.X509KeyPair(m.ClientCertPEM, clientKeyPEM)
+	if err != nil {
+		return nil, nil, errors.Join(ErrParseClientKeyPairFail, err)
+	}
+
+	return caCertPool, &clientCert, nil
+}
+
+// parsePKCS12 returns the client certificate, with its chain, and key stored in the keystore
+func parsePKCS12(data []byte, password string) (*tls.Certificate, error) {
+	key, cert, caCerts, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, errors.Join(ErrParsePKCS12Fail, err)
+	}
+
+	clientCert := &tls.Certificate{
+		Certificate: [][]byte{cert.Raw},
+		PrivateKey:  key,
+		Leaf:        cert,
+	}
+	for _, caCert := range caCerts {
+		clientCert.Certificate = append(clientCert.Certificate, caCert.Raw)
+	}
+
+	return clientCert, nil
+}
+
+// DecryptKeyPEM returns keyPEM with its private key decrypted using password.
+// Unencrypted keys are returned as is, so it's safe to call on any key.
+func DecryptKeyPEM(keyPEM []byte, password string) ([]byte, error) {
+	var decryptedPEM []byte
+
+	for rest := keyPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		//nolint:staticcheck // legacy PEM encryption is insecure but still used by older tooling
+		legacyEncrypted := x509.IsEncryptedPEMBlock(block)
+		if block.Type != "ENCRYPTED PRIVATE KEY" && !legacyEncrypted {
+			decryptedPEM = append(decryptedPEM, pem.EncodeToMemory(block)...)
+			continue
+		}
+
+		if password == "" {
+			return nil, ErrKeyPasswordRequired
+		}
+
+		if legacyEncrypted {
+			//nolint:staticcheck // see above
+			der, err := x509.DecryptPEMBlock(block, []byte(password))
+			if err != nil {
+				return nil, errors.Join(ErrIncorrectKeyPassword, err)
+			}
+			decryptedPEM = append(decryptedPEM, pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der})...)
+			continue
+		}
+
+		der, err := decryptPKCS8(block.Bytes, password)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := x509.ParsePKCS8PrivateKey(der); err != nil {
+			return nil, errors.Join(ErrIncorrectKeyPassword, err)
+		}
+		decryptedPEM = append(decryptedPEM, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})...)
+	}
+
+	return decryptedPEM, nil
+}
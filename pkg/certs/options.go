@@ -0,0 +1,161 @@
+package certs
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Option configures the TLS policy of the configs created by NewTLSConfig and Reloader
+type Option func(*options) error
+
+type options struct {
+	systemRoots        bool
+	minVersion         uint16
+	maxVersion         uint16
+	cipherSuites       []uint16
+	serverName         string
+	spkiPins           [][sha256.Size]byte
+	insecureSkipVerify bool
+}
+
+func newOptions(opts []Option) (*options, error) {
+	o := &options{
+		minVersion: tls.VersionTLS12,
+	}
+
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// WithSystemRoots trusts the system's root CAs on top of the CA PEMs. The CA PEMs become optional.
+func WithSystemRoots() Option {
+	return func(o *options) error {
+		o.systemRoots = true
+		return nil
+	}
+}
+
+// WithMinVersion sets the minimum TLS version, TLS 1.2 by default
+func WithMinVersion(version uint16) Option {
+	return func(o *options) error {
+		o.minVersion = version
+		return nil
+	}
+}
+
+// WithMaxVersion sets the maximum TLS version, the highest supported by crypto/tls by default
+func WithMaxVersion(version uint16) Option {
+	return func(o *options) error {
+		o.maxVersion = version
+		return nil
+	}
+}
+
+// WithCipherSuites restricts the TLS 1.0-1.2 cipher suites. TLS 1.3 suites aren't configurable.
+func WithCipherSuites(ids ...uint16) Option {
+	return func(o *options) error {
+		o.cipherSuites = ids
+		return nil
+	}
+}
+
+// WithServerName overrides the name the server certificate is verified against, which is
+// otherwise the host being dialed
+func WithServerName(name string) Option {
+	return func(o *options) error {
+		o.serverName = name
+		return nil
+	}
+}
+
+// WithSPKIPins only accepts servers with a certificate in their verified chain whose public key
+// matches one of pins, the base64 encoded SHA-256 hashes of the certificates' SubjectPublicKeyInfo.
+// With WithInsecureSkipVerify, only the server's own certificate is checked.
+// (e.g. `openssl x509 -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64`)
+func WithSPKIPins(pins ...string) Option {
+	return func(o *options) error {
+		for _, pin := range pins {
+			hash, err := ParseSPKIPin(pin)
+			if err != nil {
+				return err
+			}
+			o.spkiPins = append(o.spkiPins, hash)
+		}
+		return nil
+	}
+}
+
+// WithInsecureSkipVerify disables the verification of the server's certificate chain and host name.
+// SPKI pins are still checked if set. Only meant for development.
+func WithInsecureSkipVerify() Option {
+	return func(o *options) error {
+		o.insecureSkipVerify = true
+		return nil
+	}
+}
+
+// ParseSPKIPin decodes a base64 encoded SHA-256 SPKI hash
+func ParseSPKIPin(pin string) ([sha256.Size]byte, error) {
+	var hash [sha256.Size]byte
+
+	decoded, err := base64.StdEncoding.DecodeString(pin)
+	if err != nil {
+		return hash, fmt.Errorf("invalid SPKI pin %q: %w", pin, err)
+	}
+	if len(decoded) != sha256.Size {
+		return hash, fmt.Errorf("invalid SPKI pin %q: expected a %d byte SHA-256 hash but got %d bytes", pin, sha256.Size, len(decoded))
+	}
+
+	copy(hash[:], decoded)
+	return hash, nil
+}
+
+// ParseVersion parses TLS versions in the "1.2" format
+func ParseVersion(version string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToUpper(version), "TLS") {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unknown TLS version %q", version)
+	}
+}
+
+// ParseCipherSuites returns the IDs of the cipher suites named as in crypto/tls
+// e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Insecure cipher suites are rejected.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	ids := make([]uint16, 0, len(names))
+
+	for _, name := range names {
+		id, ok := cipherSuiteID(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			return suite.ID, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,137 @@
+package certs
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"slices"
+	"sync"
+)
+
+var (
+	ErrNoPeerCertificates = errors.New("no certificates presented by the server")
+	ErrSPKIPinMismatch    = errors.New("no server certificate matches the SPKI pins")
+)
+
+// Reloader serves a client certificate and CA pool that can be replaced at runtime, e.g. after
+// cert-manager rotates the certificates. The TLS configs it creates use the material current at
+// the time of each handshake, so existing connections keep working and new ones use the new certs.
+type Reloader struct {
+	load MaterialLoader
+	opts *options
+
+	mu         sync.RWMutex
+	caCertPool *x509.CertPool
+	clientCert *tls.Certificate
+}
+
+// NewReloader returns a Reloader serving the material returned by load, following the policy set by opts
+func NewReloader(load MaterialLoader, opts ...Option) (*Reloader, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reloader{load: load, opts: o}
+
+	err = r.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Reload replaces the served material with the material currently returned by the loader.
+// The current material is kept if the new material can't be parsed.
+func (r *Reloader) Reload() error {
+	caCertPool, clientCert, err := r.load().parse(r.opts)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.caCertPool = caCertPool
+	r.clientCert = clientCert
+	return nil
+}
+
+// TLSConfig returns a client TLS config backed by the reloader
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetClientCertificate: r.getClientCertificate,
+		// RootCAs can't be replaced once the config is in use, so the default verification is
+		// skipped and VerifyConnection does the same checks against the current CA pool instead
+		InsecureSkipVerify: true,
+		VerifyConnection:   r.verifyConnection,
+		ServerName:         r.opts.serverName,
+		MinVersion:         r.opts.minVersion,
+		MaxVersion:         r.opts.maxVersion,
+		CipherSuites:       r.opts.cipherSuites,
+	}
+}
+
+func (r *Reloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// an empty certificate tells the server no client certificate is available
+	if r.clientCert == nil {
+		return &tls.Certificate{}, nil
+	}
+
+	return r.clientCert, nil
+}
+
+// verifyConnection verifies the server's certificate chain and host name like crypto/tls does
+// when InsecureSkipVerify is false, unless WithInsecureSkipVerify is set, then checks the SPKI pins
+// against the verified chains, or only the server's certificate if verification is skipped, since
+// the server can present any certificate
+func (r *Reloader) verifyConnection(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return ErrNoPeerCertificates
+	}
+
+	chains := [][]*x509.Certificate{cs.PeerCertificates[:1]}
+	if !r.opts.insecureSkipVerify {
+		r.mu.RLock()
+		caCertPool := r.caCertPool
+		r.mu.RUnlock()
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range cs.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+
+		var err error
+		chains, err = cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+			DNSName:       cs.ServerName,
+			Roots:         caCertPool,
+			Intermediates: intermediates,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return r.verifySPKIPins(chains)
+}
+
+func (r *Reloader) verifySPKIPins(chains [][]*x509.Certificate) error {
+	if len(r.opts.spkiPins) == 0 {
+		return nil
+	}
+
+	for _, chain := range chains {
+		for _, cert := range chain {
+			if slices.Contains(r.opts.spkiPins, sha256.Sum256(cert.RawSubjectPublicKeyInfo)) {
+				return nil
+			}
+		}
+	}
+
+	return ErrSPKIPinMismatch
+}
@@ -1,64 +1,182 @@
 package env
 
 import (
+	"encoding"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var (
 	ErrNoValidEnvTypeProvided = errors.New("no valid environment variable data type provided")
 )
 
+const (
+	// DefaultSeparator separates the items of slices and maps
+	DefaultSeparator = ","
+	// keyValueSeparator separates the key from the value of a map item e.g. "key=value"
+	keyValueSeparator = "="
+)
+
+var (
+	durationType        = reflect.TypeFor[time.Duration]()
+	urlPtrType          = reflect.TypeFor[*url.URL]()
+	byteSliceType       = reflect.TypeFor[[]byte]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// Get looks up the environment variable name and casts its value into val
 func Get(name string, val reflect.Value) error {
 	if _, ok := os.LookupEnv(name); !ok {
 		return fmt.Errorf("unable to find environment variable named %q", name)
 	}
 
-	varStrVal := os.Getenv(name)
+	return Set(val, os.Getenv(name))
+}
 
-	// add a case statment for every data type used by config.appConfig's fields
-	// that is, a statment for every data type the environment variables will be casted to
-	switch val.Interface().(type) {
-	case uint8:
-		varIntVal, err := strconv.ParseUint(varStrVal, 10, 8)
+// Set casts the raw string value into val. It's used for values that don't come
+// from environment variables (e.g. config files, mounted secrets) so they're all
+// parsed the same way.
+func Set(val reflect.Value, varStrVal string) error {
+	return SetSep(val, varStrVal, DefaultSeparator)
+}
+
+// SetSep is Set with a custom separator for slice and map items
+func SetSep(val reflect.Value, varStrVal, sep string) error {
+	// types that need special handling go first, before falling back to their underlying kind
+	switch val.Type() {
+	case durationType:
+		duration, err := time.ParseDuration(varStrVal)
 		if err != nil {
 			return err
 		}
 
-		val.SetUint(varIntVal)
-	case uint16:
-		varIntVal, err := strconv.ParseUint(varStrVal, 10, 16)
+		val.SetInt(int64(duration))
+		return nil
+	case urlPtrType:
+		parsedURL, err := url.Parse(varStrVal)
 		if err != nil {
 			return err
 		}
 
-		val.SetUint(varIntVal)
-	case uint32:
-		varIntVal, err := strconv.ParseUint(varStrVal, 10, 32)
+		val.Set(reflect.ValueOf(parsedURL))
+		return nil
+	case byteSliceType:
+		val.SetBytes([]byte(varStrVal))
+		return nil
+	}
+
+	if unmarshaler, ok := textUnmarshaler(val); ok {
+		return unmarshaler.UnmarshalText([]byte(varStrVal))
+	}
+
+	// add a case statment for every kind of data used by config.appConfig's fields
+	// that is, a statment for every kind of data the environment variables will be casted to
+	switch val.Kind() {
+	case reflect.Bool:
+		varBoolVal, err := strconv.ParseBool(varStrVal)
+		if err != nil {
+			return err
+		}
+
+		val.SetBool(varBoolVal)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		varIntVal, err := strconv.ParseInt(varStrVal, 10, val.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		val.SetInt(varIntVal)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		varIntVal, err := strconv.ParseUint(varStrVal, 10, val.Type().Bits())
 		if err != nil {
 			return err
 		}
 
 		val.SetUint(varIntVal)
-	case int:
-		varIntVal, err := strconv.Atoi(varStrVal)
+	case reflect.Float32, reflect.Float64:
+		varFloatVal, err := strconv.ParseFloat(varStrVal, val.Type().Bits())
 		if err != nil {
 			return err
 		}
 
-		val.SetInt(int64(varIntVal))
-	case string:
+		val.SetFloat(varFloatVal)
+	case reflect.String:
 		val.SetString(varStrVal)
-	case []string:
-		splitVal := reflect.ValueOf(strings.Split(varStrVal, " "))
-		val.Set(splitVal)
+	case reflect.Slice:
+		items := splitItems(varStrVal, sep)
+		sliceVal := reflect.MakeSlice(val.Type(), len(items), len(items))
+		for i, item := range items {
+			err := SetSep(sliceVal.Index(i), item, sep)
+			if err != nil {
+				return fmt.Errorf("invalid item %d: %w", i, err)
+			}
+		}
+
+		val.Set(sliceVal)
+	case reflect.Map:
+		if val.Type().Key().Kind() != reflect.String {
+			return ErrNoValidEnvTypeProvided
+		}
+
+		items := splitItems(varStrVal, sep)
+		mapVal := reflect.MakeMapWithSize(val.Type(), len(items))
+		for _, item := range items {
+			key, itemVal, ok := strings.Cut(item, keyValueSeparator)
+			if !ok {
+				return fmt.Errorf("invalid map item %q: expected key%svalue", item, keyValueSeparator)
+			}
+
+			elemVal := reflect.New(val.Type().Elem()).Elem()
+			err := SetSep(elemVal, strings.TrimSpace(itemVal), sep)
+			if err != nil {
+				return fmt.Errorf("invalid value for map key %q: %w", key, err)
+			}
+
+			mapVal.SetMapIndex(reflect.ValueOf(strings.TrimSpace(key)).Convert(val.Type().Key()), elemVal)
+		}
+
+		val.Set(mapVal)
 	default:
 		return ErrNoValidEnvTypeProvided
 	}
 
 	return nil
 }
+
+// textUnmarshaler returns val as an encoding.TextUnmarshaler if its type (or a pointer to it)
+// implements the interface. nil pointers are allocated so they can be unmarshalled into.
+func textUnmarshaler(val reflect.Value) (encoding.TextUnmarshaler, bool) {
+	if val.Kind() == reflect.Pointer && val.Type().Implements(textUnmarshalerType) {
+		if val.IsNil() {
+			val.Set(reflect.New(val.Type().Elem()))
+		}
+
+		return val.Interface().(encoding.TextUnmarshaler), true
+	}
+
+	if val.CanAddr() && reflect.PointerTo(val.Type()).Implements(textUnmarshalerType) {
+		return val.Addr().Interface().(encoding.TextUnmarshaler), true
+	}
+
+	return nil, false
+}
+
+// splitItems splits a list, trimming the whitespace around each item. An empty string is an empty list.
+func splitItems(varStrVal, sep string) []string {
+	if strings.TrimSpace(varStrVal) == "" {
+		return []string{}
+	}
+
+	items := strings.Split(varStrVal, sep)
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+
+	return items
+}
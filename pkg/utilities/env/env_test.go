@@ -1,9 +1,12 @@
 package env_test
 
 import (
+	"errors"
+	"net/url"
 	"reflect"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/rodney-b/swish-test-consumer/pkg/utilities/env"
 )
@@ -52,3 +55,79 @@ func TestGet(t *testing.T) {
 		t.Fatalf(errBadValue, "timeoutSeconds", expected.timeoutSeconds, tc.timeoutSeconds)
 	}
 }
+
+type testTextLevel int
+
+func (tl *testTextLevel) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "low":
+		*tl = 1
+	case "high":
+		*tl = 2
+	default:
+		return errors.New("unknown level")
+	}
+
+	return nil
+}
+
+func TestSetSep(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		sep      string
+		target   any
+		expected any
+		wantErr  bool
+	}{
+		{name: "bool", raw: "true", target: new(bool), expected: true},
+		{name: "invalid bool", raw: "yes please", target: new(bool), wantErr: true},
+		{name: "int64", raw: "-9000000000", target: new(int64), expected: int64(-9000000000)},
+		{name: "uint16 overflow", raw: "70000", target: new(uint16), wantErr: true},
+		{name: "float64", raw: "0.25", target: new(float64), expected: 0.25},
+		{name: "duration", raw: "1m30s", target: new(time.Duration), expected: 90 * time.Second},
+		{name: "bytes", raw: "-----BEGIN CERTIFICATE-----", target: new([]byte), expected: []byte("-----BEGIN CERTIFICATE-----")},
+		{name: "comma separated strings", raw: "data-set-1, data-set-2", target: new([]string), expected: []string{"data-set-1", "data-set-2"}},
+		{name: "custom separator", raw: "a b c", sep: " ", target: new([]string), expected: []string{"a", "b", "c"}},
+		{name: "empty list", raw: "", target: new([]string), expected: []string{}},
+		{name: "int list", raw: "1,2,3", target: new([]int32), expected: []int32{1, 2, 3}},
+		{name: "map", raw: "team=data, env=test", target: new(map[string]string), expected: map[string]string{"team": "data", "env": "test"}},
+		{name: "invalid map item", raw: "team", target: new(map[string]string), wantErr: true},
+		{name: "text unmarshaler", raw: "high", target: new(testTextLevel), expected: testTextLevel(2)},
+		{name: "invalid text unmarshaler", raw: "medium", target: new(testTextLevel), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sep := tt.sep
+			if sep == "" {
+				sep = env.DefaultSeparator
+			}
+
+			val := reflect.ValueOf(tt.target).Elem()
+			err := env.SetSep(val, tt.raw, sep)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetSep() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if !reflect.DeepEqual(val.Interface(), tt.expected) {
+				t.Fatalf("invalid value - expected %v but got %v", tt.expected, val.Interface())
+			}
+		})
+	}
+}
+
+func TestSetURL(t *testing.T) {
+	var target *url.URL
+	err := env.Set(reflect.ValueOf(&target).Elem(), "https://collector.local:4318/v1/metrics")
+	if err != nil {
+		t.Fatalf("error setting url: %v", err)
+	}
+
+	if target.Host != "collector.local:4318" || target.Path != "/v1/metrics" {
+		t.Fatalf("invalid url - got %v", target)
+	}
+}
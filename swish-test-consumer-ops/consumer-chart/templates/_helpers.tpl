@@ -60,3 +60,27 @@ Create the name of the service account to use
 {{- default "default" .Values.serviceAccount.name }}
 {{- end }}
 {{- end }}
+
+
+{{/*
+Volume mounts shared by the consumer and its init containers
+*/}}
+{{- define "consumer-chart.volumeMounts" -}}
+- name: consumer-tls
+  mountPath: {{ .Values.config.secretsDir }}/consumer
+  readOnly: true
+- name: message-queue-ca
+  mountPath: {{ .Values.config.secretsDir }}/message-queue-ca
+  readOnly: true
+- name: message-queue-tls
+  mountPath: {{ .Values.config.secretsDir }}/message-queue
+  readOnly: true
+{{- if .Values.messageQueue.sasl.credentialsSecret }}
+- name: message-queue-sasl
+  mountPath: {{ .Values.config.secretsDir }}/message-queue-sasl
+  readOnly: true
+{{- end }}
+{{- with .Values.volumeMounts }}
+{{ toYaml . }}
+{{- end }}
+{{- end }}